@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/riccione/fileater/internal/hashcache"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the checksum cache",
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune [path...]",
+	Short: "Drop cache entries for files that are gone or have changed",
+	Long: "Prunes the per-user checksum cache and, for each path given, the cache kept in\n" +
+		"that root by --hash-cache root. Entries are dropped when their file no longer\n" +
+		"exists or its device, inode, size or modification time changed.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var paths []string
+		if path, err := hashcache.DefaultPath(); err == nil {
+			paths = append(paths, path)
+		}
+		for _, root := range args {
+			paths = append(paths, filepath.Join(root, hashcache.FileName))
+		}
+
+		for _, path := range paths {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			c, err := hashcache.Open(path)
+			if err != nil {
+				return err
+			}
+			total := c.Len()
+			pruned := c.Prune()
+			if dryRun {
+				fmt.Printf("%s: would prune %d of %d entries\n", path, pruned, total)
+				continue
+			}
+			if err := c.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("%s: pruned %d of %d entries\n", path, pruned, total)
+		}
+		return nil
+	},
+}
+
+// openHashCache opens the checksum cache selected by --hash-cache for
+// root, or returns nil when caching is off.
+func openHashCache(where, root string) (*hashcache.Cache, error) {
+	switch where {
+	case "off":
+		return nil, nil
+	case "root":
+		return hashcache.Open(filepath.Join(root, hashcache.FileName))
+	case "", "user":
+		path, err := hashcache.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		return hashcache.Open(path)
+	}
+	return nil, fmt.Errorf("unknown location %q (want user, root or off)", where)
+}
+
+func init() {
+	cacheCmd.AddCommand(cachePruneCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
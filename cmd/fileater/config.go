@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/riccione/fileater/internal/config"
+	"github.com/riccione/fileater/internal/organizer"
+)
+
+var showResolved bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and check the configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Report problems in the configuration",
+	Long: "Checks the merged configuration for path (defaults to the current directory) for\n" +
+		"duplicate extensions, extensions without a leading dot, empty and reserved\n" +
+		"categories, and category names that collide with files in path.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := rootArg(args)
+
+		res, err := config.Resolve(root, configPath)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		if len(res.Sources) == 0 {
+			fmt.Println("No config files found; the default categories are used.")
+			return nil
+		}
+		label := strings.Join(res.Sources, ", ")
+
+		// Applying to an organizer also compiles rule patterns
+		o, err := organizer.NewOrganizer(root, true, false, slog.New(slog.NewTextHandler(io.Discard, nil)), "", "", binaryUnits)
+		if err != nil {
+			return err
+		}
+		if err := o.ApplyConfig(res.Config); err != nil {
+			return fmt.Errorf("error loading config %s: %w", label, err)
+		}
+
+		issues := res.Config.Validate(root)
+		errCount := 0
+		for _, issue := range issues {
+			fmt.Println(issue)
+			if issue.Severity == config.Error {
+				errCount++
+			}
+		}
+
+		if errCount > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%s: %d error(s), %d warning(s)", label, errCount, len(issues)-errCount)
+		}
+		fmt.Printf("%s: OK, %d warning(s)\n", label, len(issues))
+		return nil
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [path]",
+	Short: "List the configuration files used for path",
+	Long: "Lists the configuration lookup chain for path (defaults to the current directory),\n" +
+		"lowest precedence first. With --resolved, prints the effective configuration and\n" +
+		"the file each entry came from.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := rootArg(args)
+
+		if !showResolved {
+			paths := config.SearchPaths(root)
+			if configPath != "" {
+				paths = append(paths, configPath)
+			}
+			for _, path := range paths {
+				status := "not found"
+				if _, err := os.Stat(path); err == nil {
+					status = "loaded"
+				}
+				fmt.Printf("%-9s  %s\n", status, path)
+			}
+			return nil
+		}
+
+		res, err := config.Resolve(root, configPath)
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		printResolved(cmd.OutOrStdout(), res)
+		return nil
+	},
+}
+
+func rootArg(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return "."
+}
+
+// printResolved writes the effective config with the origin of each entry.
+func printResolved(out io.Writer, res *config.Resolved) {
+	if len(res.Sources) == 0 {
+		fmt.Fprintln(out, "No config files found; the default categories are used.")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Sources (lowest precedence first):")
+	for i, src := range res.Sources {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, src)
+	}
+
+	cfg := res.Config
+	fmt.Fprintln(w, "\nCategories (in precedence order):")
+	for _, name := range cfg.Order {
+		entry := cfg.Categories[name]
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", name, strings.Join(entry.Ext, " "), strings.Join(res.CategoryOrigins[name], "; "))
+		for _, kv := range [][2]string{{"template", entry.Template}, {"rename", entry.Rename}, {"layout", entry.Layout}, {"dest", entry.Dest}} {
+			if kv[1] != "" {
+				fmt.Fprintf(w, "    %s: %s\t\t\n", kv[0], kv[1])
+			}
+		}
+	}
+
+	if len(cfg.Rules) > 0 {
+		fmt.Fprintln(w, "\nRules (first match wins):")
+		for i, r := range cfg.Rules {
+			fmt.Fprintf(w, "  %d. %s\t%s\t%s\n", i+1, r.Category, r, res.RuleOrigins[i])
+		}
+	}
+
+	if len(cfg.MIME) > 0 {
+		fmt.Fprintln(w, "\nMIME types:")
+		mimes := make([]string, 0, len(cfg.MIME))
+		for mime := range cfg.MIME {
+			mimes = append(mimes, mime)
+		}
+		sort.Strings(mimes)
+		for _, mime := range mimes {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", mime, cfg.MIME[mime], res.MIMEOrigins[mime])
+		}
+	}
+
+	fmt.Fprintln(w, "\nSidecars:")
+	switch {
+	case res.SidecarOrigin == "":
+		fmt.Fprintln(w, "  built-in defaults")
+	case len(cfg.Sidecars) == 0:
+		fmt.Fprintf(w, "  none\t\t%s\n", res.SidecarOrigin)
+	default:
+		for _, sc := range cfg.Sidecars {
+			primary := "any file"
+			if len(sc.Primary) > 0 {
+				primary = strings.Join(sc.Primary, " ")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", primary, strings.Join(sc.Ext, " "), res.SidecarOrigin)
+		}
+	}
+	w.Flush()
+}
+
+func init() {
+	configShowCmd.Flags().BoolVar(&showResolved, "resolved", false, "Print the effective configuration and where each entry came from")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
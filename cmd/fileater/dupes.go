@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/riccione/fileater/internal/organizer"
+	"github.com/riccione/fileater/internal/phash"
+)
+
+var (
+	dupesFormat  string
+	keepPolicy   string
+	applyDupes   bool
+	findSimilar  bool
+	phashAlgo    string
+	maxDistance  int
+	applySimilar bool
+)
+
+var dupesCmd = &cobra.Command{
+	Use:   "dupes path...",
+	Short: "Report files with identical content",
+	Long: "Scans the given trees and prints groups of identical files with their size and\n" +
+		"the space a single copy would free, as a table, JSON or CSV. Nothing is moved\n" +
+		"unless --apply is given: then every file but the one chosen by --keep is set\n" +
+		"aside with --dupe-action, recorded in the history of the first path (or --dest)\n" +
+		"and reversible with --undo.\n\n" +
+		"With --similar, images (JPEG, PNG, GIF) that look alike after resizing or\n" +
+		"re-encoding are reported as separate similar groups; they are only set aside\n" +
+		"when --apply-similar is given as well.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := organizer.ParseKeepPolicy(keepPolicy)
+		if err != nil {
+			return err
+		}
+		action, err := organizer.ParseDupeAction(dupeAction)
+		if err != nil {
+			return err
+		}
+		if applyDupes && action == organizer.DupeSkip {
+			return fmt.Errorf("--apply needs a --dupe-action other than skip")
+		}
+		algo, err := phash.ParseAlgo(phashAlgo)
+		if err != nil {
+			return err
+		}
+		if maxDistance < 0 || maxDistance > 64 {
+			return fmt.Errorf("--threshold must be between 0 and 64")
+		}
+		if applySimilar && !(applyDupes && findSimilar) {
+			return fmt.Errorf("--apply-similar needs --apply and --similar")
+		}
+		switch dupesFormat {
+		case "table", "json", "csv":
+		default:
+			return fmt.Errorf("unknown format %q (want table, json or csv)", dupesFormat)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		root := args[0]
+		if destPath != "" {
+			root = destPath
+		}
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		if logPath != "" {
+			logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return fmt.Errorf("error opening log file: %w", err)
+			}
+			defer logFile.Close()
+			logger = slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{AddSource: true}))
+		}
+
+		o, err := organizer.NewOrganizer(root, dryRun, true, logger, minSize, maxSize, binaryUnits)
+		if err != nil {
+			return err
+		}
+		o.SetDupeAction(action)
+		o.SetVerifyDupes(verifyDupes)
+		o.SetRunInfo(Version, changedFlags(cmd))
+		if policy.Category() != "" {
+			hintIgnoredConfig()
+			if err := o.LoadConfigChain(configPath); err != nil {
+				return fmt.Errorf("error loading config: %w", err)
+			}
+		}
+		cache, err := openHashCache(hashCache, root)
+		if err != nil {
+			return fmt.Errorf("error opening hash cache: %w", err)
+		}
+		if cache != nil {
+			o.SetHashCache(cache)
+		}
+
+		groups, err := o.FindDupes(ctx, args...)
+		var similar []organizer.DupeGroup
+		if err == nil && findSimilar {
+			similar, err = o.FindSimilar(ctx, algo, maxDistance, groups)
+		}
+		if cache != nil && !dryRun {
+			if saveErr := cache.Save(); saveErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save hash cache: %v\n", saveErr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		o.ApplyKeepPolicy(groups, policy)
+		o.ApplyKeepPolicy(similar, policy)
+
+		out := cmd.OutOrStdout()
+		switch dupesFormat {
+		case "json":
+			err = printDupesJSON(out, groups, similar)
+		case "csv":
+			err = printDupesCSV(out, append(groups, similar...))
+		default:
+			printDupesTable(out, groups, similar, binaryUnits)
+		}
+		if err != nil || !applyDupes {
+			return err
+		}
+		cmd.SilenceUsage = true
+		if applySimilar {
+			groups = append(groups, similar...)
+		}
+		return o.ResolveDupes(groups)
+	},
+}
+
+func printDupesTable(out io.Writer, groups, similar []organizer.DupeGroup, binary bool) {
+	var files int
+	var reclaimable int64
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, g := range groups {
+		fmt.Fprintf(w, "#%d\t%s x %d\treclaimable %s\tsha256 %.12s\n", i+1, organizer.FormatSize(g.Size, binary), len(g.Files), organizer.FormatSize(g.Reclaimable(), binary), g.SHA256)
+		printGroupFiles(w, g, binary)
+		files += len(g.Files) - 1
+		reclaimable += g.Reclaimable()
+	}
+	for i, g := range similar {
+		fmt.Fprintf(w, "~%d\t%d similar images\treclaimable %s\tdistance %d\n", i+1, len(g.Files), organizer.FormatSize(g.Reclaimable(), binary), g.Distance)
+		printGroupFiles(w, g, binary)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "%d group(s), %d duplicate file(s), %s reclaimable\n", len(groups), files, organizer.FormatSize(reclaimable, binary))
+	if len(similar) > 0 {
+		fmt.Fprintf(out, "%d group(s) of similar images\n", len(similar))
+	}
+}
+
+func printGroupFiles(w io.Writer, g organizer.DupeGroup, binary bool) {
+	for _, f := range g.Files {
+		mark := ""
+		if f == g.Keep {
+			mark = "keep"
+		}
+		if g.Similar {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\n", mark, organizer.FormatSize(g.FileSize(f), binary), f)
+		} else {
+			fmt.Fprintf(w, "\t%s\t%s\n", mark, f)
+		}
+	}
+}
+
+func printDupesJSON(out io.Writer, groups, similar []organizer.DupeGroup) error {
+	type jsonGroup struct {
+		organizer.DupeGroup
+		Reclaimable int64 `json:"reclaimable"`
+	}
+	report := struct {
+		Groups      []jsonGroup `json:"groups"`
+		Similar     []jsonGroup `json:"similar,omitempty"`
+		Reclaimable int64       `json:"reclaimable"`
+	}{Groups: []jsonGroup{}}
+	for _, g := range groups {
+		report.Groups = append(report.Groups, jsonGroup{g, g.Reclaimable()})
+		report.Reclaimable += g.Reclaimable()
+	}
+	for _, g := range similar {
+		report.Similar = append(report.Similar, jsonGroup{g, g.Reclaimable()})
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func printDupesCSV(out io.Writer, groups []organizer.DupeGroup) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"group", "kind", "size", "sha256", "path", "keep"})
+	for i, g := range groups {
+		kind := "exact"
+		if g.Similar {
+			kind = "similar"
+		}
+		for _, f := range g.Files {
+			w.Write([]string{strconv.Itoa(i + 1), kind, strconv.FormatInt(g.FileSize(f), 10), g.SHA256, f, strconv.FormatBool(f == g.Keep)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func init() {
+	dupesCmd.Flags().StringVar(&dupesFormat, "format", "table", "Output format: table, json or csv")
+	dupesCmd.Flags().StringVar(&keepPolicy, "keep", "oldest", "Which copy to keep: oldest, newest, largest, shortest (path) or category:NAME")
+	dupesCmd.Flags().BoolVar(&applyDupes, "apply", false, "Set aside every copy but the kept one with --dupe-action")
+	dupesCmd.Flags().BoolVar(&findSimilar, "similar", false, "Also report images that look alike, using perceptual hashes")
+	dupesCmd.Flags().StringVar(&phashAlgo, "phash", "dhash", "Perceptual hash for --similar: dhash, ahash or phash")
+	dupesCmd.Flags().IntVar(&maxDistance, "threshold", 10, "Largest Hamming distance (0-64) between similar images")
+	dupesCmd.Flags().BoolVar(&applySimilar, "apply-similar", false, "With --apply, set aside similar images too, not just exact duplicates")
+	rootCmd.AddCommand(dupesCmd)
+}
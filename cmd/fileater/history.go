@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/riccione/fileater/internal/history"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect the runs recorded for a root",
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list [path]",
+	Short: "List the recorded runs, oldest first",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := history.Load(rootArg(args))
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No runs recorded.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN ID\tTIME\tCOMMAND\tVERSION\tMOVED\tDUPES\tERRORS\tSTATUS")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", r.ID, formatTime(r.Time), orDash(r.Command), orDash(r.Version),
+				r.Counts.Moved, r.Counts.Duplicates, r.Counts.Errors, runStatus(r))
+		}
+		return w.Flush()
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <run-id> [path]",
+	Short: "Show what a run did",
+	Long:  "Shows the details of a run recorded for path (defaults to the current directory).\nThe run ID may be shortened to a unique prefix.",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := history.Load(rootArg(args[1:]))
+		if err != nil {
+			return err
+		}
+		run, err := history.Find(runs, args[0])
+		if err != nil {
+			return err
+		}
+		printRun(cmd.OutOrStdout(), run)
+		return nil
+	},
+}
+
+// printRun writes a run's metadata followed by the changes it made.
+func printRun(out io.Writer, r *history.Run) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%s\n", r.ID)
+	fmt.Fprintf(w, "Time:\t%s\n", formatTime(r.Time))
+	fmt.Fprintf(w, "Command:\t%s\n", orDash(r.Command))
+	fmt.Fprintf(w, "Version:\t%s\n", orDash(r.Version))
+	fmt.Fprintf(w, "Flags:\t%s\n", orDash(strings.Join(r.Flags, " ")))
+	fmt.Fprintf(w, "Config:\t%s\n", orDash(r.ConfigDigest))
+	fmt.Fprintf(w, "Root:\t%s\n", r.State.RootPath)
+	fmt.Fprintf(w, "Counts:\t%d processed, %d moved, %d duplicates, %d dirs removed, %d errors\n",
+		r.Counts.Processed, r.Counts.Moved, r.Counts.Duplicates, r.Counts.DeletedDirs, r.Counts.Errors)
+	fmt.Fprintf(w, "Status:\t%s\n", runStatus(r))
+	w.Flush()
+
+	if len(r.State.MovedFiles) > 0 {
+		fmt.Fprintln(out, "\nFiles:")
+		current := make([]string, 0, len(r.State.MovedFiles))
+		for c := range r.State.MovedFiles {
+			current = append(current, c)
+		}
+		sort.Strings(current)
+		for _, c := range current {
+			mode := r.State.Modes[c]
+			if mode == "" {
+				mode = "move"
+			}
+			fmt.Fprintf(out, "  %-8s %s => %s\n", mode, r.State.MovedFiles[c], c)
+		}
+	}
+	if len(r.State.Duplicates) > 0 {
+		fmt.Fprintln(out, "\nDuplicates:")
+		for _, d := range r.State.Duplicates {
+			fmt.Fprintf(out, "  %-10s %s (copy of %s)\n", d.Action, d.Path, d.KeptCopy)
+		}
+	}
+	if len(r.State.DeletedDirs) > 0 {
+		fmt.Fprintln(out, "\nRemoved directories:")
+		for _, dir := range r.State.DeletedDirs {
+			fmt.Fprintf(out, "  %s\n", dir)
+		}
+	}
+}
+
+func runStatus(r *history.Run) string {
+	if r.Interrupted {
+		return "interrupted"
+	}
+	if !r.UndoneAt.IsZero() {
+		return "undone " + formatTime(r.UndoneAt)
+	}
+	return "done"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	rootCmd.AddCommand(historyCmd)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"log"
 	"log/slog"
@@ -12,7 +11,9 @@ import (
 	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/riccione/fileater/internal/history"
 	"github.com/riccione/fileater/internal/organizer"
 	"github.com/riccione/fileater/internal/rollback"
 )
@@ -26,8 +27,19 @@ var (
 	logPath     string
 	minSize     string
 	maxSize     string
+	olderThan   string
+	newerThan   string
+	binaryUnits bool
+	destPath    string
+	modeFlag    string
 	deleteDupes bool
-	undo        bool
+	dupeAction  string
+	verifyDupes bool
+	undoRun     string
+	sniffMode   string
+	excludes    []string
+	includes    []string
+	hashCache   string
 )
 
 func main() {
@@ -35,21 +47,32 @@ func main() {
 }
 
 var rootCmd = &cobra.Command{
-	Use:     "fileater [path]",
+	Use:     "fileater [path...]",
 	Short:   "Organizes files recursively into categorized folders",
 	Version: Version,
-	Args:    cobra.ExactArgs(1), // Enforces exactly one path argument
+	Args:    cobra.MinimumNArgs(1), // several paths need --dest
+	// Execute prints returned errors itself
+	SilenceErrors: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		rootPath := args[0]
-
-		if undo {
-			if err := rollback.Undo(rootPath, dryRun); err != nil {
+		if undoRun != "" {
+			rootPath, runID, err := undoArgs(args)
+			if err != nil {
+				log.Fatalf("Undo failed: %v", err)
+			}
+			if err := rollback.UndoRun(rootPath, runID, dryRun, force); err != nil {
 				log.Fatalf("Undo failed: %v", err)
 			}
 			log.Println("Undo completed successfully.")
 			return
 		}
 
+		rootPath := args[0]
+		if destPath != "" {
+			rootPath = destPath
+		} else if len(args) > 1 {
+			log.Fatalf("Organizing several paths requires --dest")
+		}
+
 		if recursive && !force {
 			fmt.Println("WARNING: Recursive mode enabled. This will move files out of their current subdirs")
 			fmt.Print("Are you sure you want to proceed? (y/N): ")
@@ -85,29 +108,74 @@ var rootCmd = &cobra.Command{
 			}))
 		}
 
+		mode, err := organizer.ParseSniffMode(sniffMode)
+		if err != nil {
+			log.Fatalf("Invalid --sniff value: %v", err)
+		}
+		transfer, err := organizer.ParseTransferMode(modeFlag)
+		if err != nil {
+			log.Fatalf("Invalid --mode value: %v", err)
+		}
+		dupes, err := organizer.ParseDupeAction(dupeAction)
+		if err != nil {
+			log.Fatalf("Invalid --dupe-action value: %v", err)
+		}
+		// --delete-dupes quarantines unless an action is given
+		if deleteDupes && !cmd.Flags().Changed("dupe-action") {
+			dupes = organizer.DupeQuarantine
+		}
+		// Modes that keep or link the original never touch duplicates
+		if dupes != organizer.DupeSkip && transfer != organizer.ModeMove {
+			log.Fatalf("--dupe-action %s needs --mode move; with --mode %s the originals stay in place", dupes, transfer)
+		}
+
 		// Initialize Organizer
-		organizer, err := organizer.NewOrganizer(rootPath, dryRun, recursive, logger, minSize, maxSize, deleteDupes)
+		organizer, err := organizer.NewOrganizer(rootPath, dryRun, recursive, logger, minSize, maxSize, binaryUnits)
 		if err != nil {
 			log.Fatalf("Error initializing organizer: %v", err)
 		}
+		organizer.SetSniffMode(mode)
+		organizer.SetTransferMode(transfer)
+		organizer.SetDupeAction(dupes)
+		organizer.SetVerifyDupes(verifyDupes)
+		organizer.SetRunInfo(Version, changedFlags(cmd))
+		if destPath != "" {
+			organizer.SetSources(args...)
+		}
+		if err := organizer.SetAgeFilters(olderThan, newerThan); err != nil {
+			log.Fatalf("Error initializing organizer: %v", err)
+		}
+		if err := organizer.SetFilters(excludes, includes); err != nil {
+			log.Fatalf("Invalid --exclude/--include pattern: %v", err)
+		}
+		cache, err := openHashCache(hashCache, rootPath)
+		if err != nil {
+			log.Fatalf("Error opening hash cache: %v", err)
+		}
+		if cache != nil {
+			organizer.SetHashCache(cache)
+		}
 
-		// Check if the config file exists (either the default "config.json" or user provided)
-		if _, err := os.Stat(configPath); err == nil {
-			if err := organizer.LoadConfig(configPath); err != nil {
-				log.Fatalf("Error loading config: %v", err)
-			}
-		} else {
-			// Only log if the user explicitly provided a path that doesn't exist
-			if flag.Lookup("config").Value.String() != "config.json" {
-				log.Fatalf("Config file not found: %s", configPath)
-			}
-			// If "config.json" is missing, use internal defaults
-			organizer.UseDefaultCategories()
+		// Merge /etc, user and root configs plus --config; without any,
+		// the internal defaults are used
+		hintIgnoredConfig()
+		if err := organizer.LoadConfigChain(configPath); err != nil {
+			log.Fatalf("Error loading config: %v", err)
 		}
 
 		// Execute
-		log.Printf("Starting organization of: %s", rootPath)
-		if err := organizer.Run(ctx); err != nil {
+		if destPath != "" {
+			log.Printf("Starting organization of: %s into %s", strings.Join(args, ", "), destPath)
+		} else {
+			log.Printf("Starting organization of: %s", rootPath)
+		}
+		err = organizer.Run(ctx)
+		if cache != nil && !dryRun {
+			if saveErr := cache.Save(); saveErr != nil {
+				log.Printf("Warning: failed to save hash cache: %v", saveErr)
+			}
+		}
+		if err != nil {
 			if err == context.Canceled {
 				log.Println("Operation canceled by user.")
 			} else {
@@ -121,14 +189,81 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dryrun", "d", false, "Simulate the operation without moving files")
-	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "config.json", "Path to JSON configuration file")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Path to a configuration file (JSON, YAML or TOML) merged on top of the lookup chain")
+	rootCmd.PersistentFlags().StringVar(&destPath, "dest", "", "Create the category folders here instead of in the organized path; allows several source paths")
 	rootCmd.PersistentFlags().BoolVarP(&recursive, "recursive", "r", false, "Process subdirs recursively")
 	rootCmd.PersistentFlags().BoolVarP(&force, "force", "f", false, "Skip confirmation prompt (for scripts/automation)")
 	rootCmd.PersistentFlags().StringVarP(&logPath, "log", "l", "", "Path to log file (appended if exists)")
-	rootCmd.PersistentFlags().StringVar(&minSize, "min-size", "", "Minimum file size (e.g., 100KB, 10MB, 1GB)")
-	rootCmd.PersistentFlags().StringVar(&maxSize, "max-size", "", "Maximum file size (e.g., 100KB, 10MB, 1GB)")
-	rootCmd.PersistentFlags().BoolVarP(&deleteDupes, "delete-dupes", "", false, "Delete duplicate files instead of skipping")
-	rootCmd.PersistentFlags().BoolVar(&undo, "undo", false, "Undo the last organization run and restore original directory structure")
+	rootCmd.PersistentFlags().StringVar(&minSize, "min-size", "", "Minimum file size (e.g., 100kB, 1.5MB, 512MiB)")
+	rootCmd.PersistentFlags().StringVar(&maxSize, "max-size", "", "Maximum file size (e.g., 100kB, 1.5GB, 2GiB)")
+	rootCmd.PersistentFlags().BoolVar(&binaryUnits, "binary-units", false, "Treat KB, MB, GB and TB as powers of 1024, as before IEC units were supported")
+	rootCmd.PersistentFlags().StringVar(&olderThan, "older-than", "", "Only organize files modified before this age or time (e.g., 30d, 1w, 2024-01-31)")
+	rootCmd.PersistentFlags().StringVar(&newerThan, "newer-than", "", "Only organize files modified within this age or after this time (e.g., 2h, 2024-01-31T18:00:00Z)")
+	rootCmd.PersistentFlags().StringVar(&dupeAction, "dupe-action", "skip", "What to do with duplicates: skip, quarantine, trash or hardlink")
+	rootCmd.PersistentFlags().BoolVarP(&deleteDupes, "delete-dupes", "", false, "Deprecated: quarantines duplicates (like --dupe-action quarantine) instead of deleting them")
+	rootCmd.PersistentFlags().MarkDeprecated("delete-dupes", "duplicates are now quarantined instead of deleted; use --dupe-action quarantine (or trash) instead")
+	rootCmd.PersistentFlags().BoolVar(&verifyDupes, "verify-dupes", false, "Compare duplicates byte for byte after their hashes match")
+	rootCmd.PersistentFlags().StringVar(&modeFlag, "mode", "move", "How files are put in place: move, copy, hardlink or symlink")
+	rootCmd.PersistentFlags().StringVar(&sniffMode, "sniff", "off", "Detect file types from content: off, ext-first or content-first")
+	rootCmd.PersistentFlags().StringArrayVar(&excludes, "exclude", nil, "Skip files matching a .fileaterignore-style pattern (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&includes, "include", nil, "Process files matching a pattern even if ignored (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&hashCache, "hash-cache", "user", "Where checksums are cached between runs: user (the user cache dir), root or off")
+	rootCmd.PersistentFlags().StringVar(&undoRun, "undo", "", "Undo the last run, or the run with the given ID, and restore the original directory structure")
+	rootCmd.PersistentFlags().Lookup("undo").NoOptDefVal = undoLast
+}
+
+// hintIgnoredConfig points out a config.json in the working directory,
+// which older versions read by default and the lookup chain does not.
+func hintIgnoredConfig() {
+	if configPath != "" {
+		return
+	}
+	if _, err := os.Stat("config.json"); err == nil {
+		log.Printf("Note: ./config.json is no longer read by default; pass --config config.json or move it to ~/.config/fileater/config.json")
+	}
+}
+
+// undoLast is the --undo value when no run ID is given.
+const undoLast = "last"
+
+// undoArgs returns the root and run ID to undo. The run ID comes from
+// --undo=ID or from an argument that looks like one, so both
+// "fileater --undo ~/Downloads 20240131-180405-9f2c" and
+// "fileater --undo 20240131-180405-9f2c ~/Downloads" work.
+func undoArgs(args []string) (string, string, error) {
+	runID := ""
+	if undoRun != undoLast {
+		runID = undoRun
+	}
+
+	var paths []string
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err != nil && runID == "" && history.IsRunID(arg) {
+			runID = arg
+			continue
+		}
+		paths = append(paths, arg)
+	}
+
+	switch {
+	case destPath != "":
+		return destPath, runID, nil
+	case len(paths) == 1:
+		return paths[0], runID, nil
+	case len(paths) == 0:
+		return "", "", fmt.Errorf("no path given")
+	}
+	return "", "", fmt.Errorf("undo takes one path (the --dest of a multi-source run)")
+}
+
+// changedFlags lists the flags set on the command line, as recorded in
+// the history.
+func changedFlags(cmd *cobra.Command) []string {
+	var flags []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags = append(flags, "--"+f.Name+"="+f.Value.String())
+	})
+	return flags
 }
 
 func Execute() {
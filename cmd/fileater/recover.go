@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/riccione/fileater/internal/rollback"
+)
+
+var recoverUndo bool
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover [path]",
+	Short: "Finish or roll back a run that was interrupted",
+	Long: "Reads the journal left in path (defaults to the current directory) by a run\n" +
+		"that was cut short by a crash or power loss. The change in flight is checked\n" +
+		"on disk, and the run is recorded in the history so it can be undone later.\n" +
+		"Files the run never reached are left alone; organize again to finish them.\n" +
+		"With --rollback, everything the run did is undone instead.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rollback.Recover(rootArg(args), recoverUndo, dryRun)
+	},
+}
+
+func init() {
+	recoverCmd.Flags().BoolVar(&recoverUndo, "rollback", false, "Undo everything the interrupted run did")
+	rootCmd.AddCommand(recoverCmd)
+}
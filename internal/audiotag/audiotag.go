@@ -0,0 +1,469 @@
+// Package audiotag reads artist, album, title and track metadata from
+// MP3 (ID3v1/ID3v2), FLAC and Ogg (Vorbis comments) and M4A (MP4 atoms).
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/riccione/fileater/internal/bmff"
+)
+
+// ErrNoTags is returned when a file has no readable tags.
+var ErrNoTags = errors.New("no audio tags")
+
+// maxTagSize bounds how much is read for a single tag block.
+const maxTagSize = 16 << 20
+
+// Tags holds the fields fileater lays out a music library by.
+type Tags struct {
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+	Track       int
+	Year        string
+}
+
+func (t *Tags) empty() bool {
+	return t.Artist == "" && t.AlbumArtist == "" && t.Album == "" && t.Title == "" && t.Track == 0
+}
+
+// ReadFile extracts tags from the audio file at path.
+func ReadFile(path string) (*Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, fi.Size())
+}
+
+// Read extracts tags from r, which holds size bytes.
+func Read(r io.ReaderAt, size int64) (*Tags, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	var tags *Tags
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		tags, err = readFLAC(r, size)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		tags, err = readOgg(r, size)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		tags, err = readMP4(r, size)
+	default:
+		tags, err = readID3(r, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tags.empty() {
+		return nil, ErrNoTags
+	}
+	return tags, nil
+}
+
+// readID3 prefers an ID3v2 tag at the start of the file and falls back to
+// the fixed-size ID3v1 tag in the last 128 bytes.
+func readID3(r io.ReaderAt, size int64) (*Tags, error) {
+	tags := &Tags{}
+	if err := readID3v2(r, size, tags); err != nil && err != ErrNoTags {
+		return nil, err
+	}
+	if tags.empty() {
+		readID3v1(r, size, tags)
+	}
+	return tags, nil
+}
+
+func readID3v1(r io.ReaderAt, size int64, tags *Tags) {
+	if size < 128 {
+		return
+	}
+	buf := make([]byte, 128)
+	if _, err := r.ReadAt(buf, size-128); err != nil || string(buf[:3]) != "TAG" {
+		return
+	}
+	field := func(b []byte) string {
+		return strings.TrimSpace(latin1(bytes.TrimRight(b, "\x00 ")))
+	}
+	tags.Title = field(buf[3:33])
+	tags.Artist = field(buf[33:63])
+	tags.Album = field(buf[63:93])
+	tags.Year = field(buf[93:97])
+	// ID3v1.1 stores the track in the last comment byte after a zero
+	if buf[125] == 0 && buf[126] != 0 {
+		tags.Track = int(buf[126])
+	}
+}
+
+func readID3v2(r io.ReaderAt, size int64, tags *Tags) error {
+	hdr := make([]byte, 10)
+	if _, err := r.ReadAt(hdr, 0); err != nil || string(hdr[:3]) != "ID3" {
+		return ErrNoTags
+	}
+	major := hdr[3]
+	flags := hdr[5]
+	tagSize := int64(syncsafe(hdr[6:10]))
+	if major < 2 || major > 4 || tagSize > maxTagSize || 10+tagSize > size {
+		return ErrNoTags
+	}
+
+	buf := make([]byte, tagSize)
+	if _, err := r.ReadAt(buf, 10); err != nil {
+		return err
+	}
+	if flags&0x80 != 0 && major < 4 {
+		// Tag-wide unsynchronisation: drop the 0x00 stuffed after each 0xFF
+		buf = bytes.ReplaceAll(buf, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+
+	p := 0
+	if flags&0x40 != 0 && major >= 3 && len(buf) >= 4 {
+		// Skip the extended header
+		extSize := int(binary.BigEndian.Uint32(buf))
+		if major == 4 {
+			extSize = int(syncsafe(buf[:4]))
+		} else {
+			extSize += 4
+		}
+		p = extSize
+	}
+
+	idLen, hdrLen := 4, 10
+	if major == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for p+hdrLen <= len(buf) {
+		id := string(buf[p : p+idLen])
+		if id[0] == 0 {
+			break // padding
+		}
+		var frameSize int
+		switch major {
+		case 2:
+			frameSize = int(buf[p+3])<<16 | int(buf[p+4])<<8 | int(buf[p+5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(buf[p+4:]))
+		case 4:
+			frameSize = int(syncsafe(buf[p+4 : p+8]))
+		}
+		start := p + hdrLen
+		if frameSize < 0 || start+frameSize > len(buf) {
+			break
+		}
+		data := buf[start : start+frameSize]
+		p = start + frameSize
+
+		if major >= 3 {
+			// Compressed, encrypted or grouped frames are not worth decoding here
+			format := buf[start-1]
+			if (major == 3 && format&0xE0 != 0) || (major == 4 && format&0x4C != 0) {
+				continue
+			}
+			if major == 4 && format&0x02 != 0 {
+				data = bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+			}
+			if major == 4 && format&0x01 != 0 && len(data) >= 4 {
+				data = data[4:] // data length indicator
+			}
+		}
+
+		if len(data) == 0 || id[0] != 'T' {
+			continue
+		}
+		value := id3Text(data)
+		switch id {
+		case "TPE1", "TP1":
+			tags.Artist = value
+		case "TPE2", "TP2":
+			tags.AlbumArtist = value
+		case "TALB", "TAL":
+			tags.Album = value
+		case "TIT2", "TT2":
+			tags.Title = value
+		case "TRCK", "TRK":
+			tags.Track = parseTrack(value)
+		case "TYER", "TYE", "TDRC":
+			if len(value) >= 4 {
+				tags.Year = value[:4]
+			}
+		}
+	}
+	return nil
+}
+
+// syncsafe decodes a 28-bit integer stored 7 bits per byte.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// id3Text decodes a text frame: one encoding byte, then the string.
+// Multiple values are separated by NUL; only the first is kept.
+func id3Text(data []byte) string {
+	enc, text := data[0], data[1:]
+	var s string
+	switch enc {
+	case 0:
+		s = latin1(text)
+	case 1:
+		s = utf16String(text, nil)
+	case 2:
+		s = utf16String(text, binary.BigEndian)
+	default:
+		s = string(text)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// utf16String decodes UTF-16; a nil order means a BOM decides.
+func utf16String(b []byte, order binary.ByteOrder) string {
+	if order == nil {
+		order = binary.LittleEndian
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xFE && b[1] == 0xFF:
+				order, b = binary.BigEndian, b[2:]
+			case b[0] == 0xFF && b[1] == 0xFE:
+				b = b[2:]
+			}
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := order.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// parseTrack reads "5" or "5/12".
+func parseTrack(s string) int {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// readFLAC finds the VORBIS_COMMENT block among the metadata blocks that
+// follow the "fLaC" marker.
+func readFLAC(r io.ReaderAt, size int64) (*Tags, error) {
+	off := int64(4)
+	hdr := make([]byte, 4)
+	for off+4 <= size {
+		if _, err := r.ReadAt(hdr, off); err != nil {
+			return nil, err
+		}
+		last := hdr[0]&0x80 != 0
+		blockType := hdr[0] & 0x7F
+		blockLen := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		if off+4+blockLen > size {
+			break
+		}
+		if blockType == 4 {
+			if blockLen > maxTagSize {
+				break
+			}
+			buf := make([]byte, blockLen)
+			if _, err := r.ReadAt(buf, off+4); err != nil {
+				return nil, err
+			}
+			return parseVorbisComments(buf), nil
+		}
+		if last {
+			break
+		}
+		off += 4 + blockLen
+	}
+	return &Tags{}, nil
+}
+
+// readOgg reassembles the second logical packet of the first stream, which
+// carries the comment header for Vorbis ("\x03vorbis") and Opus ("OpusTags").
+func readOgg(r io.ReaderAt, size int64) (*Tags, error) {
+	var packet []byte
+	packets := 0
+	off := int64(0)
+	hdr := make([]byte, 27)
+
+	for off+27 <= size && len(packet) <= maxTagSize {
+		if _, err := r.ReadAt(hdr, off); err != nil {
+			return nil, err
+		}
+		if string(hdr[:4]) != "OggS" {
+			break
+		}
+		segCount := int(hdr[26])
+		lacing := make([]byte, segCount)
+		if _, err := r.ReadAt(lacing, off+27); err != nil {
+			return nil, err
+		}
+		dataOff := off + 27 + int64(segCount)
+		for _, l := range lacing {
+			if packets == 1 {
+				seg := make([]byte, l)
+				if _, err := r.ReadAt(seg, dataOff); err != nil {
+					return nil, err
+				}
+				packet = append(packet, seg...)
+			}
+			dataOff += int64(l)
+			if l < 255 {
+				// A lacing value under 255 ends the packet
+				packets++
+				if packets == 2 {
+					return parseOggComment(packet), nil
+				}
+			}
+		}
+		off = dataOff
+	}
+	return &Tags{}, nil
+}
+
+func parseOggComment(packet []byte) *Tags {
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		return parseVorbisComments(packet[7:])
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		return parseVorbisComments(packet[8:])
+	}
+	return &Tags{}
+}
+
+// parseVorbisComments decodes a little-endian vendor string followed by
+// "KEY=value" entries.
+func parseVorbisComments(b []byte) *Tags {
+	tags := &Tags{}
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+
+	if _, ok := next(); !ok { // vendor
+		return tags
+	}
+	if len(b) < 4 {
+		return tags
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		entry, ok := next()
+		if !ok {
+			break
+		}
+		key, value, found := strings.Cut(string(entry), "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(key) {
+		case "ARTIST":
+			if tags.Artist == "" {
+				tags.Artist = value
+			}
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			tags.AlbumArtist = value
+		case "ALBUM":
+			tags.Album = value
+		case "TITLE":
+			tags.Title = value
+		case "TRACKNUMBER":
+			tags.Track = parseTrack(value)
+		case "DATE", "YEAR":
+			if len(value) >= 4 {
+				tags.Year = value[:4]
+			}
+		}
+	}
+	return tags
+}
+
+// readMP4 reads the iTunes-style item list at moov/udta/meta/ilst.
+func readMP4(r io.ReaderAt, size int64) (*Tags, error) {
+	tags := &Tags{}
+	ilst, err := bmff.FindPath(r, 0, size, []string{"moov", "udta", "meta", "ilst"}, "meta")
+	if err != nil {
+		return tags, nil
+	}
+
+	for off := ilst.Start; off < ilst.End(); {
+		item, err := bmff.ReadBox(r, off, ilst.End())
+		if err != nil {
+			break
+		}
+		off = item.Next
+
+		data, err := bmff.Find(r, item.Start, item.End(), "data")
+		if err != nil || data.Size < 8 || data.Size > maxTagSize {
+			continue
+		}
+		// data payload: 4 bytes type indicator, 4 bytes locale, then value
+		buf := make([]byte, data.Size-8)
+		if _, err := r.ReadAt(buf, data.Start+8); err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(buf))
+
+		switch item.Type {
+		case "\xa9ART":
+			tags.Artist = value
+		case "aART":
+			tags.AlbumArtist = value
+		case "\xa9alb":
+			tags.Album = value
+		case "\xa9nam":
+			tags.Title = value
+		case "\xa9day":
+			if len(value) >= 4 {
+				tags.Year = value[:4]
+			}
+		case "trkn":
+			if len(buf) >= 4 {
+				tags.Track = int(binary.BigEndian.Uint16(buf[2:]))
+			}
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,230 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func id3v2(major byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...) // padding
+	n := len(body)
+	hdr := []byte{'I', 'D', '3', major, 0, 0,
+		byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	return append(hdr, body...)
+}
+
+func textFrame(major byte, id string, enc byte, text []byte) []byte {
+	data := append([]byte{enc}, text...)
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	n := len(data)
+	switch major {
+	case 2:
+		buf.Write([]byte{byte(n >> 16), byte(n >> 8), byte(n)})
+	case 3:
+		binary.Write(&buf, binary.BigEndian, uint32(n))
+		buf.Write([]byte{0, 0})
+	case 4:
+		buf.Write([]byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F), 0, 0})
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func utf16LE(s string) []byte {
+	out := []byte{0xFF, 0xFE}
+	for _, c := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, c)
+	}
+	return out
+}
+
+func vorbisComments(entries ...string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(6))
+	buf.WriteString("vendor")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(entries)))
+	for _, e := range entries {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(e)))
+		buf.WriteString(e)
+	}
+	return buf.Bytes()
+}
+
+func flacFile(comments []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	// STREAMINFO, then VORBIS_COMMENT marked as the last block
+	buf.Write([]byte{0x00, 0x00, 0x00, 34})
+	buf.Write(make([]byte, 34))
+	n := len(comments)
+	buf.Write([]byte{0x84, byte(n >> 16), byte(n >> 8), byte(n)})
+	buf.Write(comments)
+	return buf.Bytes()
+}
+
+func oggPage(seq uint32, packet []byte) []byte {
+	var lacing []byte
+	n := len(packet)
+	for n >= 255 {
+		lacing = append(lacing, 255)
+		n -= 255
+	}
+	lacing = append(lacing, byte(n))
+
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.Write([]byte{0, 0})
+	buf.Write(make([]byte, 8)) // granule position
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, seq)
+	buf.Write(make([]byte, 4)) // checksum, not verified
+	buf.WriteByte(byte(len(lacing)))
+	buf.Write(lacing)
+	buf.Write(packet)
+	return buf.Bytes()
+}
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	out = append(out, typ...)
+	return append(out, body...)
+}
+
+func mp4Item(typ string, value []byte) []byte {
+	return mp4Box(typ, mp4Box("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, value))
+}
+
+func TestRead(t *testing.T) {
+	// A long comment forces the Ogg packet across several lacing values
+	longComment := "COMMENT=" + string(bytes.Repeat([]byte("x"), 600))
+
+	id3v1 := make([]byte, 200)
+	tag := id3v1[len(id3v1)-128:]
+	copy(tag, "TAG")
+	copy(tag[3:], "Yellow Submarine")
+	copy(tag[33:], "The Beatles")
+	copy(tag[63:], "Revolver")
+	copy(tag[93:], "1966")
+	tag[126] = 7
+
+	tests := []struct {
+		name string
+		data []byte
+		want Tags
+	}{
+		{
+			"ID3v2.3",
+			append(id3v2(3,
+				textFrame(3, "TPE1", 0, []byte("Daft Punk")),
+				textFrame(3, "TALB", 1, utf16LE("Discovery")),
+				textFrame(3, "TIT2", 3, []byte("One More Time")),
+				textFrame(3, "TRCK", 0, []byte("1/14")),
+				textFrame(3, "TYER", 0, []byte("2001")),
+			), 0xFF, 0xFB),
+			Tags{Artist: "Daft Punk", Album: "Discovery", Title: "One More Time", Track: 1, Year: "2001"},
+		},
+		{
+			"ID3v2.4",
+			id3v2(4,
+				textFrame(4, "TPE1", 3, []byte("Björk")),
+				textFrame(4, "TPE2", 3, []byte("Björk")),
+				textFrame(4, "TALB", 3, []byte("Homogenic")),
+				textFrame(4, "TIT2", 3, []byte("Jóga")),
+				textFrame(4, "TRCK", 3, []byte("3")),
+				textFrame(4, "TDRC", 3, []byte("1997-09-22")),
+			),
+			Tags{Artist: "Björk", AlbumArtist: "Björk", Album: "Homogenic", Title: "Jóga", Track: 3, Year: "1997"},
+		},
+		{
+			"ID3v2.2",
+			id3v2(2,
+				textFrame(2, "TP1", 0, []byte("Portishead")),
+				textFrame(2, "TT2", 0, []byte("Roads")),
+				textFrame(2, "TRK", 0, []byte("4")),
+			),
+			Tags{Artist: "Portishead", Title: "Roads", Track: 4},
+		},
+		{
+			"ID3v1.1",
+			id3v1,
+			Tags{Artist: "The Beatles", Album: "Revolver", Title: "Yellow Submarine", Track: 7, Year: "1966"},
+		},
+		{
+			"FLAC",
+			flacFile(vorbisComments("ARTIST=Radiohead", "album=OK Computer", "TITLE=Airbag", "TRACKNUMBER=01", "DATE=1997")),
+			Tags{Artist: "Radiohead", Album: "OK Computer", Title: "Airbag", Track: 1, Year: "1997"},
+		},
+		{
+			"Ogg Vorbis",
+			append(oggPage(0, []byte("\x01vorbis-identification")),
+				oggPage(1, append([]byte("\x03vorbis"), vorbisComments("ARTIST=Air", "ALBUM=Moon Safari", "TITLE=La Femme d'Argent", "TRACKNUMBER=1", longComment)...))...),
+			Tags{Artist: "Air", Album: "Moon Safari", Title: "La Femme d'Argent", Track: 1},
+		},
+		{
+			"M4A",
+			append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+				mp4Box("moov", mp4Box("udta", mp4Box("meta", []byte{0, 0, 0, 0}, mp4Box("hdlr", make([]byte, 25)),
+					mp4Box("ilst",
+						mp4Item("\xa9ART", []byte("Massive Attack")),
+						mp4Item("\xa9alb", []byte("Mezzanine")),
+						mp4Item("\xa9nam", []byte("Teardrop")),
+						mp4Item("trkn", []byte{0, 0, 0, 3, 0, 11, 0, 0}),
+						mp4Item("\xa9day", []byte("1998-04-20")),
+					))))...),
+			Tags{Artist: "Massive Attack", Album: "Mezzanine", Title: "Teardrop", Track: 3, Year: "1998"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Read = %+v; want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRead_NoTags(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"Bare MP3 Frame": {0xFF, 0xFB, 0x90, 0x64, 0, 0, 0, 0},
+		"Empty FLAC":     flacFile(vorbisComments()),
+		"Empty":          nil,
+		// a 64-bit box size that overflows when added to its offset
+		"Corrupt M4A": append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+			mp4Box("moov", mp4Box("udta", mp4Box("meta", []byte{0, 0, 0, 0},
+				mp4Box("ilst", mp4Box("\xa9ART", []byte("\x00\x00\x00\x01data\x7f\xff\xff\xff\xff\xff\xff\xfcArtist"))))))...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(data), int64(len(data))); err == nil {
+				t.Error("expected error for untagged file")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	data := id3v2(3, textFrame(3, "TPE1", 0, []byte("Moby")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if tags.Artist != "Moby" {
+		t.Errorf("Artist = %q; want Moby", tags.Artist)
+	}
+}
@@ -0,0 +1,96 @@
+// Package bmff walks the box structure of ISO base media files (MP4, M4A,
+// MOV, HEIF).
+package bmff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned by Find when no box of the requested type exists.
+var ErrNotFound = errors.New("box not found")
+
+// Box is a box header.
+type Box struct {
+	Type string
+	// Start is the offset of the payload and Size its length.
+	Start int64
+	Size  int64
+	// Next is the offset of the following sibling box.
+	Next int64
+}
+
+// End returns the offset just past the payload.
+func (b Box) End() int64 {
+	return b.Start + b.Size
+}
+
+// ReadBox reads the header of the box at off, which must end before end.
+func ReadBox(r io.ReaderAt, off, end int64) (Box, error) {
+	hdr := make([]byte, 16)
+	if off+8 > end {
+		return Box{}, io.EOF
+	}
+	if _, err := r.ReadAt(hdr[:8], off); err != nil {
+		return Box{}, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr))
+	typ := string(hdr[4:8])
+	hdrLen := int64(8)
+	switch size {
+	case 0:
+		// Box extends to the end of its container
+		size = end - off
+	case 1:
+		if _, err := r.ReadAt(hdr[8:16], off+8); err != nil {
+			return Box{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		hdrLen = 16
+	}
+	// compared without adding, since a 64-bit size can overflow off+size
+	if size < hdrLen || size > end-off {
+		return Box{}, fmt.Errorf("corrupt %q box", typ)
+	}
+	return Box{Type: typ, Start: off + hdrLen, Size: size - hdrLen, Next: off + size}, nil
+}
+
+// Find returns the first box of the given type among the siblings between
+// off and end.
+func Find(r io.ReaderAt, off, end int64, typ string) (Box, error) {
+	for off < end {
+		b, err := ReadBox(r, off, end)
+		if err != nil {
+			return Box{}, err
+		}
+		if b.Type == typ {
+			return b, nil
+		}
+		off = b.Next
+	}
+	return Box{}, ErrNotFound
+}
+
+// FindPath descends through nested boxes, e.g. "moov", "udta", "meta".
+// Full boxes listed in fullBoxes have their 4-byte version and flags
+// skipped before their children are searched.
+func FindPath(r io.ReaderAt, off, end int64, path []string, fullBoxes ...string) (Box, error) {
+	var b Box
+	for _, typ := range path {
+		var err error
+		b, err = Find(r, off, end, typ)
+		if err != nil {
+			return Box{}, err
+		}
+		off, end = b.Start, b.End()
+		for _, full := range fullBoxes {
+			if full == typ {
+				off += 4
+				break
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,73 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func box(typ string, payload []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(8+len(payload)))
+	buf.WriteString(typ)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// largeBox builds a box with a 64-bit size field holding size.
+func largeBox(typ string, size uint64, payload []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	buf.WriteString(typ)
+	binary.Write(&buf, binary.BigEndian, size)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestReadBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		off     int64
+		want    Box
+		wantErr bool
+	}{
+		{"Compact", box("free", []byte("abcd")), 0, Box{Type: "free", Start: 8, Size: 4, Next: 12}, false},
+		{"Large", largeBox("mdat", 20, []byte("abcd")), 0, Box{Type: "mdat", Start: 16, Size: 4, Next: 20}, false},
+		{"To End", append([]byte{0, 0, 0, 0}, "mdat12"...), 0, Box{Type: "mdat", Start: 8, Size: 2, Next: 10}, false},
+		{"Past End", box("free", []byte("abcd"))[:10], 0, Box{}, true},
+		{"Smaller Than Header", []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, 0, Box{}, true},
+		{"Large Overflowing", append(box("free", nil), largeBox("iinf", 1<<63-4, []byte("abcd"))...), 8, Box{}, true},
+		{"Large Negative", largeBox("iinf", 1<<63, []byte("abcd")), 0, Box{}, true},
+		{"Truncated Header", []byte{0, 0, 0}, 0, Box{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadBox(bytes.NewReader(tt.data), tt.off, int64(len(tt.data)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadBox error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadBox = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPath(t *testing.T) {
+	meta := append([]byte{0, 0, 0, 0}, box("ilst", []byte("tags"))...)
+	data := append(box("ftyp", []byte("M4A ")), box("moov", box("udta", box("meta", meta)))...)
+
+	b, err := FindPath(bytes.NewReader(data), 0, int64(len(data)), []string{"moov", "udta", "meta", "ilst"}, "meta")
+	if err != nil {
+		t.Fatalf("FindPath failed: %v", err)
+	}
+	if got := string(data[b.Start:b.End()]); got != "tags" {
+		t.Errorf("payload = %q; want %q", got, "tags")
+	}
+
+	if _, err := Find(bytes.NewReader(data), 0, int64(len(data)), "mdat"); err != ErrNotFound {
+		t.Errorf("Find of a missing box = %v; want ErrNotFound", err)
+	}
+}
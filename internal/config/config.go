@@ -0,0 +1,253 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CurrentVersion is the newest config schema version understood by fileater.
+const CurrentVersion = 2
+
+// Config is the decoded form of a fileater configuration file.
+//
+// Version 1 is the original flat format, a JSON object mapping category
+// names to extension lists. Version 2 wraps the same map under "categories"
+// and adds an ordered list of rules that are evaluated before it, plus an
+// optional MIME type mapping used by content sniffing.
+type Config struct {
+	Version    int                 `json:"version"`
+	Categories map[string]Category `json:"categories,omitempty"`
+	// Order lists the category names in the order they appear in the file.
+	// When an extension is listed by several categories the first one wins.
+	Order []string `json:"-"`
+	Rules []Rule   `json:"rules,omitempty"`
+	// MIME maps detected content types to categories for content sniffing.
+	// Keys are exact types ("application/pdf") or wildcards ("image/*").
+	MIME map[string]string `json:"mime,omitempty"`
+	// Sidecars lists groups of files that move together with a primary
+	// file of the same base name. Nil keeps the built-in groups; an empty
+	// list turns grouping off.
+	Sidecars []Sidecar `json:"sidecars,omitempty"`
+
+	// duplicateKeys lists the keys a JSON file gives twice, for Validate
+	// to report; the last value is used
+	duplicateKeys []string
+}
+
+// Category holds the settings of one category. In config files it is
+// written either as a plain list of extensions or as an object, or as null
+// to drop a category inherited from an earlier file in the lookup chain.
+type Category struct {
+	Ext []string `json:"ext"`
+	// Add and Remove patch the extensions inherited from an earlier file
+	// in the lookup chain instead of replacing the category.
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+	// Drop is set for a category written as null.
+	Drop bool `json:"-"`
+	// Template is an optional destination path relative to the root, such
+	// as "images/{mtime:2006}/{mtime:01}". It defaults to the category name.
+	Template string `json:"template,omitempty"`
+	// Rename is an optional template for the new file name without its
+	// extension, such as "IMG_{taken:20060102_150405}".
+	Rename string `json:"rename,omitempty"`
+	// Layout selects a built-in arrangement instead of the template.
+	// "media" sorts recognizable videos into TV/ and Movies/ folders.
+	Layout string `json:"layout,omitempty"`
+	// Dest is an optional absolute or "~/"-relative folder used instead
+	// of the category folder in the root, e.g. "~/Pictures/Inbox". A
+	// template's leading directory stands for this folder.
+	Dest string `json:"dest,omitempty"`
+}
+
+// IsPatch reports whether the category modifies an inherited one rather
+// than replacing it.
+func (c Category) IsPatch() bool {
+	return c.Ext == nil && (len(c.Add) > 0 || len(c.Remove) > 0)
+}
+
+// Rule routes files to a category when every condition it sets matches.
+// Conditions left empty are ignored, so a rule with only a category is a
+// catch-all.
+type Rule struct {
+	Category string `json:"category"`
+	// Name is a glob matched against the file name (case-insensitive).
+	Name string `json:"name,omitempty"`
+	// Regex is a regular expression matched against the file name.
+	Regex string `json:"regex,omitempty"`
+	// Ext lists extensions (with leading dot) the file must have one of.
+	Ext []string `json:"ext,omitempty"`
+	// MinSize and MaxSize bound the file size, e.g. "100KB" or "2GB".
+	MinSize string `json:"min_size,omitempty"`
+	MaxSize string `json:"max_size,omitempty"`
+	// OlderThan and NewerThan bound the modification age, e.g. "30d".
+	OlderThan string `json:"older_than,omitempty"`
+	NewerThan string `json:"newer_than,omitempty"`
+	// Parent is a glob matched against the parent directory, either its
+	// name or its slash-separated path relative to the root.
+	Parent string `json:"parent,omitempty"`
+}
+
+// Sidecar describes files such as subtitles or XMP metadata that follow a
+// primary file sharing their base name ("movie.mkv" and "movie.en.srt").
+// The primary's category decides where the whole group goes.
+type Sidecar struct {
+	// Ext lists the sidecar extensions (with leading dot).
+	Ext []string `json:"ext"`
+	// Primary optionally restricts which extensions the primary file may
+	// have. When empty any file that is not itself a sidecar qualifies.
+	Primary []string `json:"primary,omitempty"`
+}
+
+// String describes the rule's conditions, e.g. "name=*.pdf min_size=1MB".
+func (r Rule) String() string {
+	var parts []string
+	add := func(key, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	add("name", r.Name)
+	add("regex", r.Regex)
+	add("ext", strings.Join(r.Ext, ","))
+	add("min_size", r.MinSize)
+	add("max_size", r.MaxSize)
+	add("older_than", r.OlderThan)
+	add("newer_than", r.NewerThan)
+	add("parent", r.Parent)
+	if len(parts) == 0 {
+		return "(any file)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Load reads and decodes the config file at path, which may be written in
+// JSON, YAML or TOML (see DetectFormat).
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseFormat(data, DetectFormat(path, data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, dup := range cfg.duplicateKeys {
+		cfg.duplicateKeys[i] = path + ": " + dup
+	}
+	return cfg, nil
+}
+
+// Parse decodes config data in either the flat (version 1) or the
+// versioned (version 2+) format, guessing the syntax from the content.
+func Parse(data []byte) (*Config, error) {
+	return ParseFormat(data, DetectFormat("", data))
+}
+
+// CategoryNames returns every category the config routes files to: the
+// extension categories in precedence order, then those only named by
+// rules or the MIME table.
+func (c *Config) CategoryNames() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	add := func(name string) {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range c.orderedCategories() {
+		add(name)
+	}
+	for _, r := range c.Rules {
+		add(r.Category)
+	}
+	mimes := make([]string, 0, len(c.MIME))
+	for mime := range c.MIME {
+		mimes = append(mimes, mime)
+	}
+	sort.Strings(mimes)
+	for _, mime := range mimes {
+		add(c.MIME[mime])
+	}
+	return names
+}
+
+// orderedCategories returns the names in Categories in precedence order:
+// file order first, then categories built in code alphabetically.
+func (c *Config) orderedCategories() []string {
+	names := make([]string, 0, len(c.Categories))
+	seen := make(map[string]struct{}, len(c.Categories))
+	for _, name := range c.Order {
+		if _, ok := c.Categories[name]; !ok {
+			continue
+		}
+		if _, dup := seen[name]; !dup {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	var rest []string
+	for name := range c.Categories {
+		if _, ok := seen[name]; !ok {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// Digest returns a short SHA-256 of the config, including the category
+// order, so runs made with the same effective config can be recognized.
+func (c *Config) Digest() string {
+	data, err := json.Marshal(struct {
+		*Config
+		Order []string `json:"order"`
+	}{c, c.Order})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CheckCategoryName reports whether name is usable as a single directory
+// name below the root.
+func CheckCategoryName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("empty category name")
+	case name == "." || name == "..":
+		return fmt.Errorf("category %q: reserved name", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("category %q: name must not contain path separators", name)
+	}
+	return nil
+}
+
+// IsDestPath reports whether dest is usable as a category destination:
+// an absolute path or one starting with "~/" (or "~").
+func IsDestPath(dest string) bool {
+	return dest == "~" || strings.HasPrefix(dest, "~/") || filepath.IsAbs(dest)
+}
+
+// ExpandDest resolves a leading "~" in a category destination to the home
+// directory and cleans the path.
+func ExpandDest(dest string) (string, error) {
+	if dest != "~" && !strings.HasPrefix(dest, "~/") {
+		return filepath.Clean(dest), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot expand %q: %w", dest, err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(dest, "~")), nil
+}
@@ -0,0 +1,566 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_FlatFormat(t *testing.T) {
+	data := []byte(`{"docs": [".pdf", ".txt"], "video": [".mp4"]}`)
+
+	cfg, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cfg.Version != 1 {
+		t.Errorf("expected version 1, got %d", cfg.Version)
+	}
+	if len(cfg.Categories["docs"].Ext) != 2 {
+		t.Errorf("expected 2 docs extensions, got %d", len(cfg.Categories["docs"].Ext))
+	}
+	if len(cfg.Rules) != 0 {
+		t.Errorf("flat format should not produce explicit rules, got %d", len(cfg.Rules))
+	}
+}
+
+func TestParse_Versioned(t *testing.T) {
+	data := []byte(`{
+		"version": 2,
+		"categories": {"docs": [".pdf"]},
+		"rules": [
+			{"category": "finance", "name": "invoice_*", "ext": [".pdf"]},
+			{"category": "big", "min_size": "2GB"}
+		]
+	}`)
+
+	cfg, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cfg.Version != 2 {
+		t.Errorf("expected version 2, got %d", cfg.Version)
+	}
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(cfg.Rules))
+	}
+	if cfg.Rules[0].Category != "finance" || cfg.Rules[1].Category != "big" {
+		t.Errorf("rules out of order: %+v", cfg.Rules)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Invalid JSON", `{"docs": `},
+		{"Unsupported Version", `{"version": 99}`},
+		{"Unknown Field", `{"version": 2, "rulez": []}`},
+		{"Rule Without Category", `{"version": 2, "rules": [{"name": "*.pdf"}]}`},
+		{"Flat With Bad Value", `{"docs": ".pdf"}`},
+		{"Sidecar Without Ext", `{"version": 2, "sidecars": [{"primary": [".shp"]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil {
+				t.Errorf("expected error for %s", tt.data)
+			}
+		})
+	}
+}
+
+func TestParse_PreservesCategoryOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Flat", `{"zeta": [".a"], "alpha": [".b"], "mid": [".c"]}`},
+		{"Versioned", `{"version": 2, "categories": {"zeta": [".a"], "alpha": [".b"], "mid": [".c"]}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			want := []string{"zeta", "alpha", "mid"}
+			if len(cfg.Order) != len(want) {
+				t.Fatalf("Order = %v; want %v", cfg.Order, want)
+			}
+			for i := range want {
+				if cfg.Order[i] != want[i] {
+					t.Errorf("Order = %v; want %v", cfg.Order, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestParse_UnsafeCategoryNames(t *testing.T) {
+	tests := []string{
+		`{"..": [".txt"]}`,
+		`{"docs/sub": [".txt"]}`,
+		`{"": [".txt"]}`,
+		`{"version": 2, "rules": [{"category": "../etc"}]}`,
+		`{"version": 2, "mime": {"image/*": "a\\b"}}`,
+	}
+
+	for _, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Parse([]byte(`{
+		"docs": [".txt", "csv", ".txt"],
+		"notes": [".txt", ".md"],
+		"empty": [],
+		"mix": [".tmp"]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	issues := cfg.Validate(tmpDir)
+
+	expected := []struct {
+		severity Severity
+		contains string
+	}{
+		{Error, `"csv" has no leading dot`},
+		{Warning, `"docs" lists ".txt" more than once`},
+		{Warning, `".txt" is listed by "docs" and "notes"; "docs" takes precedence`},
+		{Warning, `"empty" lists no extensions`},
+		{Error, `"mix" is reserved`},
+		{Error, `"notes" collides with existing file`},
+	}
+
+	for _, want := range expected {
+		found := false
+		for _, issue := range issues {
+			if issue.Severity == want.severity && strings.Contains(issue.Message, want.contains) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing %s containing %q in %v", want.severity, want.contains, issues)
+		}
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+}
+
+func TestValidate_CleanConfig(t *testing.T) {
+	cfg, err := Parse([]byte(`{"docs": [".txt"], "video": [".mp4"]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if issues := cfg.Validate(t.TempDir()); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
+
+func TestValidate_DuplicateJSONKey(t *testing.T) {
+	cfg, err := Parse([]byte("{\"docs\": [\".txt\"],\n \"video\": [\".mp4\"],\n \"docs\": [\".pdf\"]}"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// the last value wins and the first position is kept, as before
+	if got := cfg.Categories["docs"].Ext; len(got) != 1 || got[0] != ".pdf" {
+		t.Errorf("docs = %v; want [.pdf]", got)
+	}
+	if len(cfg.Order) != 2 || cfg.Order[0] != "docs" {
+		t.Errorf("Order = %v; want [docs video]", cfg.Order)
+	}
+
+	issues := cfg.Validate("")
+	if len(issues) != 1 || issues[0].Severity != Warning || !strings.Contains(issues[0].Message, `line 3, column 2: duplicate key "docs"`) {
+		t.Errorf("Validate = %v; want a warning about the duplicate key", issues)
+	}
+}
+
+func TestParse_CategoryObjectForm(t *testing.T) {
+	data := []byte(`{
+		"images": {"ext": [".jpg"], "template": "images/{mtime:2006}"},
+		"docs": [".pdf"]
+	}`)
+
+	cfg, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	images := cfg.Categories["images"]
+	if len(images.Ext) != 1 || images.Template != "images/{mtime:2006}" {
+		t.Errorf("unexpected images category: %+v", images)
+	}
+	if len(cfg.Categories["docs"].Ext) != 1 {
+		t.Errorf("unexpected docs category: %+v", cfg.Categories["docs"])
+	}
+
+	if _, err := Parse([]byte(`{"images": {"extensions": [".jpg"]}}`)); err == nil {
+		t.Error("expected error for unknown category field")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	parse := func(data string) *Config {
+		t.Helper()
+		cfg, err := Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		return cfg
+	}
+
+	res := Merge(
+		Layer{Path: "system", Config: parse(`{
+			"version": 2,
+			"categories": {
+				"images": [".jpg", ".png", ".bmp"],
+				"docs": {"ext": [".pdf"], "template": "docs/{ext}"},
+				"old": [".tmp"]
+			},
+			"rules": [{"category": "docs", "name": "invoice*"}],
+			"mime": {"image/*": "images", "application/pdf": "docs"}
+		}`)},
+		Layer{Path: "root", Config: parse(`{
+			"images": {"add": [".HEIC", ".jpg"], "remove": [".BMP"], "template": "images/{mtime:2006}"},
+			"docs": [".pdf", ".txt"],
+			"old": null,
+			"video": [".mkv"]
+		}`)},
+		Layer{Path: "explicit", Config: parse(`{
+			"version": 2,
+			"rules": [{"category": "video", "ext": [".ts"]}],
+			"mime": {"image/*": "photos"},
+			"sidecars": []
+		}`)},
+	)
+
+	cfg := res.Config
+	if want := []string{"images", "docs", "video"}; !reflect.DeepEqual(cfg.Order, want) {
+		t.Errorf("Order = %v; want %v", cfg.Order, want)
+	}
+	images := cfg.Categories["images"]
+	if want := []string{".jpg", ".png", ".HEIC"}; !reflect.DeepEqual(images.Ext, want) {
+		t.Errorf("images ext = %v; want %v", images.Ext, want)
+	}
+	if images.Template != "images/{mtime:2006}" {
+		t.Errorf("images template = %q; patch should set it", images.Template)
+	}
+	if docs := cfg.Categories["docs"]; docs.Template != "" || len(docs.Ext) != 2 {
+		t.Errorf("docs = %+v; replacing should drop the inherited template", docs)
+	}
+	if _, ok := cfg.Categories["old"]; ok {
+		t.Error("null should drop the inherited category")
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[0].Category != "video" || res.RuleOrigins[0] != "explicit" {
+		t.Errorf("later rules should come first: %+v %v", cfg.Rules, res.RuleOrigins)
+	}
+	if cfg.MIME["image/*"] != "photos" || cfg.MIME["application/pdf"] != "docs" || res.MIMEOrigins["image/*"] != "explicit" {
+		t.Errorf("MIME = %v, origins %v", cfg.MIME, res.MIMEOrigins)
+	}
+	if cfg.Sidecars == nil || len(cfg.Sidecars) != 0 || res.SidecarOrigin != "explicit" {
+		t.Errorf("empty sidecars should override the defaults: %v from %q", cfg.Sidecars, res.SidecarOrigin)
+	}
+	if want := []string{"system", "root (+.HEIC +.jpg -.BMP)"}; !reflect.DeepEqual(res.CategoryOrigins["images"], want) {
+		t.Errorf("images origins = %v; want %v", res.CategoryOrigins["images"], want)
+	}
+	if want := []string{"root"}; !reflect.DeepEqual(res.CategoryOrigins["docs"], want) {
+		t.Errorf("docs origins = %v; want %v", res.CategoryOrigins["docs"], want)
+	}
+}
+
+func TestParse_PatchWithExt(t *testing.T) {
+	if _, err := Parse([]byte(`{"docs": {"ext": [".pdf"], "add": [".txt"]}}`)); err == nil {
+		t.Error("expected error for ext combined with add")
+	}
+}
+
+func TestParse_Dest(t *testing.T) {
+	cfg, err := Parse([]byte(`{"images": {"ext": [".jpg"], "dest": "~/Pictures/Inbox"}, "docs": {"ext": [".pdf"], "dest": "/srv/share/docs"}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if cfg.Categories["images"].Dest != "~/Pictures/Inbox" || cfg.Categories["docs"].Dest != "/srv/share/docs" {
+		t.Errorf("unexpected dests: %+v", cfg.Categories)
+	}
+
+	if _, err := Parse([]byte(`{"images": {"ext": [".jpg"], "dest": "Pictures"}}`)); err == nil || !strings.Contains(err.Error(), "absolute") {
+		t.Errorf("expected error for a relative dest, got %v", err)
+	}
+
+	// A patch moves an inherited category without touching its extensions
+	res := Merge(
+		Layer{Path: "a", Config: cfg},
+		Layer{Path: "b", Config: &Config{Categories: map[string]Category{"images": {Add: []string{".png"}, Dest: "~/Photos"}}}},
+	)
+	if got := res.Config.Categories["images"]; got.Dest != "~/Photos" || len(got.Ext) != 2 {
+		t.Errorf("patched images = %+v", got)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	if got, _ := ExpandDest("~/Pictures"); got != filepath.Join(home, "Pictures") {
+		t.Errorf("ExpandDest = %q", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	sys, user, root := t.TempDir(), t.TempDir(), t.TempDir()
+	oldSystem, oldUser := systemDir, userConfigDir
+	systemDir = sys
+	userConfigDir = func() (string, error) { return user, nil }
+	t.Cleanup(func() { systemDir, userConfigDir = oldSystem, oldUser })
+
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := Resolve(root, "")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(res.Sources) != 0 {
+		t.Errorf("expected no sources, got %v", res.Sources)
+	}
+
+	write(filepath.Join(sys, "config.json"), `{"docs": [".pdf"]}`)
+	write(filepath.Join(user, "fileater", "config.json"), `{"docs": {"add": [".txt"]}}`)
+	write(filepath.Join(root, ".fileater.json"), `{"docs": {"add": [".md"]}}`)
+	explicit := filepath.Join(t.TempDir(), "extra.json")
+	write(explicit, `{"docs": {"remove": [".pdf"]}}`)
+
+	res, err = Resolve(root, explicit)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(sys, "config.json"),
+		filepath.Join(user, "fileater", "config.json"),
+		filepath.Join(root, ".fileater.json"),
+		explicit,
+	}
+	if !reflect.DeepEqual(res.Sources, want) {
+		t.Errorf("Sources = %v; want %v", res.Sources, want)
+	}
+	if got := res.Config.Categories["docs"].Ext; !reflect.DeepEqual(got, []string{".txt", ".md"}) {
+		t.Errorf("docs ext = %v", got)
+	}
+
+	if _, err := Resolve(root, filepath.Join(root, "missing.json")); err == nil {
+		t.Error("expected error for a missing explicit config")
+	}
+
+	write(filepath.Join(root, ".fileater.json"), `{"docs": `)
+	if _, err := Resolve(root, ""); err == nil || !strings.Contains(err.Error(), ".fileater.json") {
+		t.Errorf("expected error naming the broken file, got %v", err)
+	}
+}
+
+func TestParseFormat_YAMLAndTOML(t *testing.T) {
+	yamlData := `
+# Comments explain why an extension is where it is
+version: 2
+categories:
+  images: [.jpg, .png]   # screenshots too
+  docs:
+    ext: [.pdf]
+    template: "docs/{ext}"
+  old: ~
+rules:
+  - category: docs
+    name: "invoice*"
+mime:
+  image/*: images
+sidecars: []
+`
+	tomlData := `
+# Comments explain why an extension is where it is
+version = 2
+sidecars = []
+
+[categories]
+images = [".jpg", ".png"]  # screenshots too
+
+[categories.docs]
+ext = [".pdf"]
+template = "docs/{ext}"
+
+[[rules]]
+category = "docs"
+name = "invoice*"
+
+[mime]
+"image/*" = "images"
+`
+
+	for _, tt := range []struct {
+		name   string
+		data   string
+		format Format
+	}{
+		{"YAML", yamlData, YAML},
+		{"TOML", tomlData, TOML},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat("", []byte(tt.data)); got != tt.format {
+				t.Errorf("DetectFormat = %v; want %v", got, tt.format)
+			}
+			cfg, err := ParseFormat([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("ParseFormat failed: %v", err)
+			}
+
+			if cfg.Version != 2 {
+				t.Errorf("Version = %d", cfg.Version)
+			}
+			if want := []string{"images", "docs"}; !reflect.DeepEqual(cfg.Order[:2], want) {
+				t.Errorf("Order = %v; want prefix %v", cfg.Order, want)
+			}
+			if got := cfg.Categories["images"].Ext; !reflect.DeepEqual(got, []string{".jpg", ".png"}) {
+				t.Errorf("images ext = %v", got)
+			}
+			if docs := cfg.Categories["docs"]; docs.Template != "docs/{ext}" || len(docs.Ext) != 1 {
+				t.Errorf("docs = %+v", docs)
+			}
+			if len(cfg.Rules) != 1 || cfg.Rules[0].Name != "invoice*" {
+				t.Errorf("Rules = %+v", cfg.Rules)
+			}
+			if cfg.MIME["image/*"] != "images" {
+				t.Errorf("MIME = %v", cfg.MIME)
+			}
+			if cfg.Sidecars == nil || len(cfg.Sidecars) != 0 {
+				t.Errorf("Sidecars = %v; want empty, not nil", cfg.Sidecars)
+			}
+		})
+	}
+}
+
+func TestParseFormat_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		data     string
+		line     int
+		col      int
+		contains string
+	}{
+		{"JSON Syntax", JSON, "{\n  \"docs\": [\".pdf\",]\n}", 2, 19, "invalid character"},
+		{"JSON Bad Value", JSON, "{\n  \"docs\": \".pdf\"\n}", 2, 11, `category "docs" must be a list`},
+		{"JSON Unknown Key", JSON, "{\"version\": 2,\n \"rulez\": []}", 2, 2, `unknown key "rulez"`},
+		{"YAML Bad Entry", YAML, "docs:\n  - .pdf\n  - [.txt]\n", 3, 5, "must be a string"},
+		{"YAML Unknown Field", YAML, "docs:\n  ext: [.pdf]\n  extension: [.txt]\n", 3, 3, `unknown key "extension"`},
+		{"YAML Rule Without Category", YAML, "version: 2\nrules:\n  - name: '*.pdf'\n", 3, 5, "rule 1: missing category"},
+		{"YAML Unquoted Number", YAML, "archives: [.zip, .001]\n", 1, 18, "must be a string, not a number"},
+		{"TOML Syntax", TOML, "docs = [\".pdf\"\nvideo = 1\n", 2, 1, ""},
+		{"TOML Bad Version", TOML, "version = 7\n", 1, 11, "unsupported config version 7"},
+		{"TOML Bad Entry", TOML, "version = 2\n[categories]\ndocs = [\".pdf\", 3]\n", 3, 17, "must be a string"},
+		{"TOML Duplicate Table", TOML, "[docs]\next = []\n[docs]\n", 3, 2, "defined twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFormat([]byte(tt.data), tt.format)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if perr.Line != tt.line || perr.Col != tt.col {
+				t.Errorf("position = %d:%d; want %d:%d (%v)", perr.Line, perr.Col, tt.line, tt.col, err)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("error %q does not mention %q", err, tt.contains)
+			}
+		})
+	}
+
+	// YAML syntax errors come from the YAML parser and name the line
+	_, err := ParseFormat([]byte("docs: [.pdf\nvideo: x\n"), YAML)
+	if err == nil || !strings.Contains(err.Error(), "line") {
+		t.Errorf("expected YAML syntax error with a line number, got %v", err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+		want Format
+	}{
+		{"config.json", "", JSON},
+		{"config.YML", "", YAML},
+		{"config.yaml", "", YAML},
+		{"config.toml", "", TOML},
+		{"config", "  {\"docs\": []}", JSON},
+		{"config", "# comment\n[categories]\n", TOML},
+		{"config", "version = 2\n", TOML},
+		{"config", "docs: [.pdf]\n", YAML},
+		{"config", "- .pdf\n", YAML},
+	}
+
+	for _, tt := range tests {
+		if got := DetectFormat(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %v; want %v", tt.path, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLoad_ReportsPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("docs: .pdf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), path+": line 1, column 7") {
+		t.Errorf("expected error naming file and position, got %v", err)
+	}
+}
+
+func TestParseFormat_DateLiterals(t *testing.T) {
+	tomlData := "version = 2\n[[rules]]\ncategory = \"archive\"\nolder_than = 2024-01-31T18:00:00Z\n"
+	yamlData := "version: 2\nrules:\n  - category: archive\n    newer_than: 2024-01-31\n"
+
+	cfg, err := ParseFormat([]byte(tomlData), TOML)
+	if err != nil {
+		t.Fatalf("TOML: %v", err)
+	}
+	if cfg.Rules[0].OlderThan != "2024-01-31T18:00:00Z" {
+		t.Errorf("TOML older_than = %q", cfg.Rules[0].OlderThan)
+	}
+
+	cfg, err = ParseFormat([]byte(yamlData), YAML)
+	if err != nil {
+		t.Fatalf("YAML: %v", err)
+	}
+	if cfg.Rules[0].NewerThan != "2024-01-31" {
+		t.Errorf("YAML newer_than = %q", cfg.Rules[0].NewerThan)
+	}
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError reports a bad entry in a config file by its position.
+type ParseError struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e *ParseError) Error() string {
+	if e.Col > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Col, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+type nodeKind int
+
+const (
+	kindNull nodeKind = iota
+	kindString
+	kindNumber
+	kindBool
+	kindDate
+	kindArray
+	kindObject
+)
+
+func (k nodeKind) String() string {
+	switch k {
+	case kindString:
+		return "a string"
+	case kindNumber:
+		return "a number"
+	case kindBool:
+		return "a boolean"
+	case kindDate:
+		return "a date"
+	case kindArray:
+		return "a list"
+	case kindObject:
+		return "an object"
+	}
+	return "null"
+}
+
+// node is a config document decoded from JSON, YAML or TOML, keeping the
+// position of every value and key so errors can point at them.
+type node struct {
+	kind      nodeKind
+	line, col int
+	// text holds strings, and numbers, booleans and dates as written
+	text    string
+	items   []*node
+	members []member
+}
+
+type member struct {
+	key       string
+	line, col int
+	value     *node
+}
+
+func (n *node) errorf(format string, args ...any) error {
+	return &ParseError{Line: n.line, Col: n.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (m member) errorf(format string, args ...any) error {
+	return &ParseError{Line: m.line, Col: m.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// get returns the member with the given key.
+func (n *node) get(key string) (member, bool) {
+	for _, m := range n.members {
+		if m.key == key {
+			return m, true
+		}
+	}
+	return member{}, false
+}
+
+// add appends a member, rejecting duplicate keys.
+func (n *node) add(m member) error {
+	if _, dup := n.get(m.key); dup {
+		return m.errorf("duplicate key %q", m.key)
+	}
+	n.members = append(n.members, m)
+	return nil
+}
+
+// set appends a member, or replaces the value of an earlier one with the
+// same key and reports true.
+func (n *node) set(m member) bool {
+	for i := range n.members {
+		if n.members[i].key == m.key {
+			n.members[i].value = m.value
+			return true
+		}
+	}
+	n.members = append(n.members, m)
+	return false
+}
+
+func (n *node) str(what string) (string, error) {
+	if n.kind != kindString {
+		return "", n.errorf("%s must be a string, not %s", what, n.kind)
+	}
+	return n.text, nil
+}
+
+// age is str that also takes the date and time literals of YAML and TOML,
+// which become the text they were written as.
+func (n *node) age(what string) (string, error) {
+	if n.kind == kindDate {
+		return n.text, nil
+	}
+	return n.str(what)
+}
+
+func (n *node) strs(what string) ([]string, error) {
+	if n.kind != kindArray {
+		return nil, n.errorf("%s must be a list of strings, not %s", what, n.kind)
+	}
+	out := make([]string, 0, len(n.items))
+	for _, item := range n.items {
+		s, err := item.str(what + " entries")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// decodeDocument turns a document into a Config. Without a "version" key
+// every member is a category (version 1); otherwise the version 2 layout
+// applies. Unknown keys are rejected so typos don't go unnoticed.
+func decodeDocument(doc *node) (*Config, error) {
+	if doc.kind == kindNull {
+		return &Config{Version: 1, Categories: map[string]Category{}}, nil
+	}
+	if doc.kind != kindObject {
+		return nil, doc.errorf("config must be an object, not %s", doc.kind)
+	}
+
+	if _, ok := doc.get("version"); !ok {
+		cfg := &Config{Version: 1}
+		var err error
+		cfg.Categories, cfg.Order, err = decodeCategories(doc)
+		if err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+
+	cfg := &Config{Categories: map[string]Category{}}
+	for _, m := range doc.members {
+		var err error
+		switch m.key {
+		case "version":
+			cfg.Version, err = decodeVersion(m.value)
+		case "categories":
+			if m.value.kind != kindNull {
+				cfg.Categories, cfg.Order, err = decodeCategories(m.value)
+			}
+		case "rules":
+			cfg.Rules, err = decodeRules(m.value)
+		case "mime":
+			cfg.MIME, err = decodeMIME(m.value)
+		case "sidecars":
+			cfg.Sidecars, err = decodeSidecars(m.value)
+		default:
+			err = m.errorf("unknown key %q", m.key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func decodeVersion(n *node) (int, error) {
+	if n.kind != kindNumber {
+		return 0, n.errorf("version must be a number, not %s", n.kind)
+	}
+	v, err := strconv.ParseInt(strings.ReplaceAll(n.text, "_", ""), 0, 0)
+	if err != nil {
+		return 0, n.errorf("version must be a whole number, not %s", n.text)
+	}
+	if v < 2 || v > CurrentVersion {
+		return 0, n.errorf("unsupported config version %d (supported: 2-%d)", v, CurrentVersion)
+	}
+	return int(v), nil
+}
+
+func decodeCategories(n *node) (map[string]Category, []string, error) {
+	if n.kind != kindObject {
+		return nil, nil, n.errorf("categories must be an object, not %s", n.kind)
+	}
+	cats := make(map[string]Category, len(n.members))
+	order := make([]string, 0, len(n.members))
+	for _, m := range n.members {
+		if err := CheckCategoryName(m.key); err != nil {
+			return nil, nil, m.errorf("%v", err)
+		}
+		cat, err := decodeCategory(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		cats[m.key] = cat
+		order = append(order, m.key)
+	}
+	return cats, order, nil
+}
+
+// decodeCategory accepts a list of extensions, an object, or null to drop
+// an inherited category.
+func decodeCategory(m member) (Category, error) {
+	n := m.value
+	what := fmt.Sprintf("category %q", m.key)
+	switch n.kind {
+	case kindNull:
+		return Category{Drop: true}, nil
+	case kindArray:
+		exts, err := n.strs(what)
+		return Category{Ext: exts}, err
+	case kindObject:
+	default:
+		return Category{}, n.errorf("%s must be a list of extensions or an object, not %s", what, n.kind)
+	}
+
+	var c Category
+	for _, f := range n.members {
+		var err error
+		field := fmt.Sprintf("%s: %s", what, f.key)
+		switch f.key {
+		case "ext":
+			c.Ext, err = f.value.strs(field)
+		case "add":
+			c.Add, err = f.value.strs(field)
+		case "remove":
+			c.Remove, err = f.value.strs(field)
+		case "template":
+			c.Template, err = f.value.str(field)
+		case "rename":
+			c.Rename, err = f.value.str(field)
+		case "layout":
+			c.Layout, err = f.value.str(field)
+		case "dest":
+			c.Dest, err = f.value.str(field)
+			if err == nil && !IsDestPath(c.Dest) {
+				err = f.value.errorf("%s: dest %q must be absolute or start with ~/", what, c.Dest)
+			}
+		default:
+			err = f.errorf("%s: unknown key %q", what, f.key)
+		}
+		if err != nil {
+			return Category{}, err
+		}
+	}
+	if c.Ext != nil && (len(c.Add) > 0 || len(c.Remove) > 0) {
+		return Category{}, n.errorf("%s: ext replaces the category and cannot be combined with add or remove", what)
+	}
+	return c, nil
+}
+
+func decodeRules(n *node) ([]Rule, error) {
+	if n.kind == kindNull {
+		return nil, nil
+	}
+	if n.kind != kindArray {
+		return nil, n.errorf("rules must be a list, not %s", n.kind)
+	}
+
+	rules := make([]Rule, 0, len(n.items))
+	for i, item := range n.items {
+		what := fmt.Sprintf("rule %d", i+1)
+		if item.kind != kindObject {
+			return nil, item.errorf("%s must be an object, not %s", what, item.kind)
+		}
+
+		var r Rule
+		for _, f := range item.members {
+			var err error
+			field := what + ": " + f.key
+			switch f.key {
+			case "category":
+				r.Category, err = f.value.str(field)
+				if err == nil && r.Category != "" {
+					if nameErr := CheckCategoryName(r.Category); nameErr != nil {
+						err = f.value.errorf("%s: %v", what, nameErr)
+					}
+				}
+			case "name":
+				r.Name, err = f.value.str(field)
+			case "regex":
+				r.Regex, err = f.value.str(field)
+			case "ext":
+				r.Ext, err = f.value.strs(field)
+			case "min_size":
+				r.MinSize, err = f.value.str(field)
+			case "max_size":
+				r.MaxSize, err = f.value.str(field)
+			case "older_than":
+				r.OlderThan, err = f.value.age(field)
+			case "newer_than":
+				r.NewerThan, err = f.value.age(field)
+			case "parent":
+				r.Parent, err = f.value.str(field)
+			default:
+				err = f.errorf("%s: unknown key %q", what, f.key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r.Category == "" {
+			return nil, item.errorf("%s: missing category", what)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func decodeMIME(n *node) (map[string]string, error) {
+	if n.kind == kindNull {
+		return nil, nil
+	}
+	if n.kind != kindObject {
+		return nil, n.errorf("mime must be an object, not %s", n.kind)
+	}
+
+	mime := make(map[string]string, len(n.members))
+	for _, m := range n.members {
+		what := fmt.Sprintf("mime %q", m.key)
+		cat, err := m.value.str(what)
+		if err != nil {
+			return nil, err
+		}
+		if cat == "" {
+			return nil, m.value.errorf("%s: missing category", what)
+		}
+		if err := CheckCategoryName(cat); err != nil {
+			return nil, m.value.errorf("%s: %v", what, err)
+		}
+		mime[m.key] = cat
+	}
+	return mime, nil
+}
+
+// decodeSidecars keeps an empty list distinct from a missing one, which
+// turns grouping off instead of keeping the defaults.
+func decodeSidecars(n *node) ([]Sidecar, error) {
+	if n.kind == kindNull {
+		return nil, nil
+	}
+	if n.kind != kindArray {
+		return nil, n.errorf("sidecars must be a list, not %s", n.kind)
+	}
+
+	groups := make([]Sidecar, 0, len(n.items))
+	for i, item := range n.items {
+		what := fmt.Sprintf("sidecar %d", i+1)
+		if item.kind != kindObject {
+			return nil, item.errorf("%s must be an object, not %s", what, item.kind)
+		}
+
+		var sc Sidecar
+		for _, f := range item.members {
+			var err error
+			switch f.key {
+			case "ext":
+				sc.Ext, err = f.value.strs(what + ": ext")
+			case "primary":
+				sc.Primary, err = f.value.strs(what + ": primary")
+			default:
+				err = f.errorf("%s: unknown key %q", what, f.key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(sc.Ext) == 0 {
+			return nil, item.errorf("%s: missing ext", what)
+		}
+		groups = append(groups, sc)
+	}
+	return groups, nil
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format is a config file syntax.
+type Format int
+
+const (
+	JSON Format = iota
+	YAML
+	TOML
+)
+
+func (f Format) String() string {
+	switch f {
+	case YAML:
+		return "YAML"
+	case TOML:
+		return "TOML"
+	}
+	return "JSON"
+}
+
+// tomlLineRe matches the first meaningful line of a TOML document: a table
+// header or a bare key assignment.
+var tomlLineRe = regexp.MustCompile(`^(\[.*\]|[A-Za-z0-9_.-]+\s*=)`)
+
+// DetectFormat picks the syntax of a config file from its extension
+// (.json, .yaml, .yml or .toml), falling back to its content when the
+// extension is missing or unknown.
+func DetectFormat(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	case ".toml":
+		return TOML
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return JSON
+		case tomlLineRe.MatchString(line):
+			return TOML
+		}
+		return YAML
+	}
+	return JSON
+}
+
+// ParseFormat decodes config data written in the given syntax.
+func ParseFormat(data []byte, f Format) (*Config, error) {
+	var doc *node
+	var dups []string
+	var err error
+	switch f {
+	case YAML:
+		doc, err = readYAML(data)
+	case TOML:
+		doc, err = readTOML(data)
+	default:
+		doc, dups, err = readJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	cfg.duplicateKeys = dups
+	return cfg, nil
+}
+
+// lineCol converts a byte offset into a 1-based line and column.
+func lineCol(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, offset - bytes.LastIndexByte(before, '\n')
+}
+
+type jsonReader struct {
+	data []byte
+	dec  *json.Decoder
+	// keys given twice in an object, by position
+	dups []string
+}
+
+// readJSON decodes a JSON document. A key given twice in an object keeps
+// its first position and takes the last value, as with encoding/json;
+// the duplicates are returned for Validate to report.
+func readJSON(data []byte) (*node, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	r := &jsonReader{data: data, dec: dec}
+
+	doc, err := r.value()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		line, col := r.next()
+		return nil, nil, &ParseError{Line: line, Col: col, Msg: "unexpected data after the top-level object"}
+	}
+	return doc, r.dups, nil
+}
+
+// next returns the position of the next token, skipping the whitespace and
+// separators the decoder has not consumed yet.
+func (r *jsonReader) next() (int, int) {
+	off := int(r.dec.InputOffset())
+	for off < len(r.data) && strings.IndexByte(" \t\r\n,:", r.data[off]) >= 0 {
+		off++
+	}
+	return lineCol(r.data, off)
+}
+
+func (r *jsonReader) token() (json.Token, int, int, error) {
+	line, col := r.next()
+	tok, err := r.dec.Token()
+	if err != nil {
+		var syntax *json.SyntaxError
+		switch {
+		case errors.As(err, &syntax):
+			line, col = lineCol(r.data, int(syntax.Offset))
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			line, col = lineCol(r.data, len(r.data))
+			err = errors.New("unexpected end of input")
+		}
+		return nil, 0, 0, &ParseError{Line: line, Col: col, Msg: err.Error()}
+	}
+	return tok, line, col, nil
+}
+
+func (r *jsonReader) value() (*node, error) {
+	tok, line, col, err := r.token()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{line: line, col: col}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			n.kind = kindArray
+			for r.dec.More() {
+				item, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+		} else {
+			n.kind = kindObject
+			for r.dec.More() {
+				tok, line, col, err := r.token()
+				if err != nil {
+					return nil, err
+				}
+				val, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				m := member{key: tok.(string), line: line, col: col, value: val}
+				if n.set(m) {
+					r.dups = append(r.dups, m.errorf("duplicate key %q", m.key).Error())
+				}
+			}
+		}
+		// closing delimiter
+		if _, _, _, err := r.token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.kind, n.text = kindString, t
+	case json.Number:
+		n.kind, n.text = kindNumber, t.String()
+	case bool:
+		n.kind, n.text = kindBool, strconv.FormatBool(t)
+	case nil:
+		n.kind = kindNull
+	}
+	return n, nil
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Locations of the lookup chain, replaceable in tests.
+var (
+	systemDir     = "/etc/fileater"
+	userConfigDir = os.UserConfigDir
+)
+
+// configExts are the file types tried for config.* in the system and user
+// directories and for .fileater.* in the root, in order.
+var configExts = []string{".json", ".yaml", ".yml", ".toml"}
+
+// rootConfigBase is the per-directory config file inside the root, without
+// its extension.
+const rootConfigBase = ".fileater"
+
+// IsRootConfig reports whether name is a per-directory config file, which
+// the organizer leaves in place.
+func IsRootConfig(name string) bool {
+	for _, ext := range configExts {
+		if name == rootConfigBase+ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Layer is one config file of the lookup chain.
+type Layer struct {
+	Path   string
+	Config *Config
+}
+
+// Resolved is the effective config after merging the lookup chain, along
+// with where each entry came from.
+type Resolved struct {
+	Config *Config
+	// Sources lists the files that were merged, lowest precedence first.
+	Sources []string
+	// CategoryOrigins describes, per category, the files that defined or
+	// patched it, e.g. "/etc/fileater/config.json" or "~/.fileater.json
+	// (+.heic -.bmp)".
+	CategoryOrigins map[string][]string
+	// RuleOrigins holds the file each rule in Config.Rules came from.
+	RuleOrigins []string
+	// MIMEOrigins holds the file each MIME mapping came from.
+	MIMEOrigins map[string]string
+	// SidecarOrigin is the file that set the sidecar groups, if any.
+	SidecarOrigin string
+}
+
+// SearchPaths returns the lookup chain for root, lowest precedence first:
+// /etc/fileater/config.*, the user config directory's fileater/config.*
+// ($XDG_CONFIG_HOME or ~/.config on Linux) and .fileater.* in root. For
+// each directory the first existing file is used, trying .json, .yaml,
+// .yml and .toml, or the .json name when there is none; the paths need
+// not exist.
+func SearchPaths(root string) []string {
+	dirs := []string{systemDir}
+	if dir, err := userConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "fileater"))
+	}
+
+	var paths []string
+	for _, dir := range dirs {
+		paths = append(paths, firstExisting(filepath.Join(dir, "config")))
+	}
+	if root != "" {
+		paths = append(paths, firstExisting(filepath.Join(root, rootConfigBase)))
+	}
+	return paths
+}
+
+// firstExisting returns base plus the first config extension that exists,
+// or base plus .json.
+func firstExisting(base string) string {
+	for _, ext := range configExts {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + configExts[0]
+}
+
+// Resolve loads and merges the lookup chain for root. A non-empty explicit
+// path, as given with --config, is merged last and must exist.
+func Resolve(root, explicit string) (*Resolved, error) {
+	var layers []Layer
+	for _, path := range SearchPaths(root) {
+		cfg, err := Load(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{Path: path, Config: cfg})
+	}
+
+	if explicit != "" {
+		cfg, err := Load(explicit)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{Path: explicit, Config: cfg})
+	}
+
+	return Merge(layers...), nil
+}
+
+// Merge applies layers in order, each overriding the ones before it:
+//
+//   - a category given as a list or with "ext" replaces the inherited one
+//   - a category with "add"/"remove" patches the inherited extensions and
+//     overrides only the template, rename, layout and dest it sets
+//   - a category given as null is dropped
+//   - rules of later layers are evaluated before those of earlier ones
+//   - MIME mappings override per type, and sidecars replace as a whole
+func Merge(layers ...Layer) *Resolved {
+	r := &Resolved{
+		Config:          &Config{Version: 1, Categories: make(map[string]Category)},
+		CategoryOrigins: make(map[string][]string),
+		MIMEOrigins:     make(map[string]string),
+	}
+	for _, l := range layers {
+		r.apply(l)
+		r.Sources = append(r.Sources, l.Path)
+	}
+	return r
+}
+
+func (r *Resolved) apply(l Layer) {
+	cfg, eff := l.Config, r.Config
+	if cfg.Version > eff.Version {
+		eff.Version = cfg.Version
+	}
+	eff.duplicateKeys = append(eff.duplicateKeys, cfg.duplicateKeys...)
+
+	for _, name := range cfg.orderedCategories() {
+		entry := cfg.Categories[name]
+		prev, exists := eff.Categories[name]
+
+		switch {
+		case entry.Drop:
+			delete(eff.Categories, name)
+			delete(r.CategoryOrigins, name)
+			eff.Order = removeName(eff.Order, name)
+			continue
+		case entry.IsPatch():
+			prev.Ext = patchExts(prev.Ext, entry.Add, entry.Remove)
+			if entry.Template != "" {
+				prev.Template = entry.Template
+			}
+			if entry.Rename != "" {
+				prev.Rename = entry.Rename
+			}
+			if entry.Layout != "" {
+				prev.Layout = entry.Layout
+			}
+			if entry.Dest != "" {
+				prev.Dest = entry.Dest
+			}
+			eff.Categories[name] = prev
+			r.CategoryOrigins[name] = append(r.CategoryOrigins[name], l.Path+" ("+patchSummary(entry)+")")
+		default:
+			eff.Categories[name] = Category{
+				Ext:      entry.Ext,
+				Template: entry.Template,
+				Rename:   entry.Rename,
+				Layout:   entry.Layout,
+				Dest:     entry.Dest,
+			}
+			r.CategoryOrigins[name] = []string{l.Path}
+		}
+		if !exists {
+			eff.Order = append(eff.Order, name)
+		}
+	}
+
+	if len(cfg.Rules) > 0 {
+		eff.Rules = append(append([]Rule{}, cfg.Rules...), eff.Rules...)
+		origins := make([]string, len(cfg.Rules))
+		for i := range origins {
+			origins[i] = l.Path
+		}
+		r.RuleOrigins = append(origins, r.RuleOrigins...)
+	}
+
+	for mime, cat := range cfg.MIME {
+		if eff.MIME == nil {
+			eff.MIME = make(map[string]string)
+		}
+		eff.MIME[mime] = cat
+		r.MIMEOrigins[mime] = l.Path
+	}
+
+	if cfg.Sidecars != nil {
+		eff.Sidecars = cfg.Sidecars
+		r.SidecarOrigin = l.Path
+	}
+}
+
+// patchExts removes extensions from the inherited list and then appends
+// the added ones, comparing case-insensitively and keeping the order.
+func patchExts(exts, add, remove []string) []string {
+	drop := make(map[string]struct{}, len(remove))
+	for _, ext := range remove {
+		drop[strings.ToLower(ext)] = struct{}{}
+	}
+
+	out := make([]string, 0, len(exts)+len(add))
+	have := make(map[string]struct{}, len(exts)+len(add))
+	keep := func(ext string) {
+		lower := strings.ToLower(ext)
+		if _, dup := have[lower]; !dup {
+			have[lower] = struct{}{}
+			out = append(out, ext)
+		}
+	}
+	for _, ext := range exts {
+		if _, gone := drop[strings.ToLower(ext)]; !gone {
+			keep(ext)
+		}
+	}
+	for _, ext := range add {
+		keep(ext)
+	}
+	return out
+}
+
+func patchSummary(c Category) string {
+	var parts []string
+	for _, ext := range c.Add {
+		parts = append(parts, "+"+ext)
+	}
+	for _, ext := range c.Remove {
+		parts = append(parts, "-"+ext)
+	}
+	return strings.Join(parts, " ")
+}
+
+func removeName(names []string, name string) []string {
+	out := names[:0]
+	for _, n := range names {
+		if n != name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+type tomlReader struct {
+	p unstable.Parser
+	// tables opened by a [header], which may not be opened twice
+	defined map[*node]bool
+}
+
+func readTOML(data []byte) (*node, error) {
+	r := &tomlReader{defined: make(map[*node]bool)}
+	r.p.Reset(data)
+
+	root := &node{kind: kindObject, line: 1, col: 1}
+	current := root
+	for r.p.NextExpression() {
+		e := r.p.Expression()
+		var err error
+		switch e.Kind {
+		case unstable.Table:
+			current, err = r.table(root, e)
+		case unstable.ArrayTable:
+			current, err = r.arrayTable(root, e)
+		case unstable.KeyValue:
+			err = r.keyValue(current, e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.p.Error(); err != nil {
+		// the decoder reports where the syntax error is
+		var derr *toml.DecodeError
+		if !errors.As(toml.Unmarshal(data, new(any)), &derr) {
+			return nil, err
+		}
+		line, col := derr.Position()
+		return nil, &ParseError{Line: line, Col: col, Msg: strings.TrimPrefix(derr.Error(), "toml: ")}
+	}
+	return root, nil
+}
+
+func (r *tomlReader) pos(n *unstable.Node) (int, int) {
+	start := r.p.Shape(n.Raw).Start
+	return start.Line, start.Column
+}
+
+type tomlKey struct {
+	name      string
+	line, col int
+}
+
+func (r *tomlReader) keys(e *unstable.Node) []tomlKey {
+	var keys []tomlKey
+	it := e.Key()
+	for it.Next() {
+		k := it.Node()
+		line, col := r.pos(k)
+		keys = append(keys, tomlKey{name: string(k.Data), line: line, col: col})
+	}
+	return keys
+}
+
+// child returns the table named by k inside t, creating it when missing.
+// For an array of tables it returns the last one, as TOML specifies.
+func child(t *node, k tomlKey) (*node, error) {
+	if m, ok := t.get(k.name); ok {
+		v := m.value
+		if v.kind == kindArray && len(v.items) > 0 && v.items[len(v.items)-1].kind == kindObject {
+			v = v.items[len(v.items)-1]
+		}
+		if v.kind != kindObject {
+			return nil, &ParseError{Line: k.line, Col: k.col, Msg: fmt.Sprintf("key %q is already set and is not a table", k.name)}
+		}
+		return v, nil
+	}
+	c := &node{kind: kindObject, line: k.line, col: k.col}
+	t.members = append(t.members, member{key: k.name, line: k.line, col: k.col, value: c})
+	return c, nil
+}
+
+func (r *tomlReader) table(root *node, e *unstable.Node) (*node, error) {
+	keys := r.keys(e)
+	t := root
+	for _, k := range keys {
+		var err error
+		if t, err = child(t, k); err != nil {
+			return nil, err
+		}
+	}
+	if r.defined[t] {
+		last := keys[len(keys)-1]
+		return nil, &ParseError{Line: last.line, Col: last.col, Msg: fmt.Sprintf("table %q is defined twice", last.name)}
+	}
+	r.defined[t] = true
+	return t, nil
+}
+
+func (r *tomlReader) arrayTable(root *node, e *unstable.Node) (*node, error) {
+	keys := r.keys(e)
+	t := root
+	for _, k := range keys[:len(keys)-1] {
+		var err error
+		if t, err = child(t, k); err != nil {
+			return nil, err
+		}
+	}
+
+	last := keys[len(keys)-1]
+	item := &node{kind: kindObject, line: last.line, col: last.col}
+	if m, ok := t.get(last.name); ok {
+		if m.value.kind != kindArray {
+			return nil, &ParseError{Line: last.line, Col: last.col, Msg: fmt.Sprintf("key %q is already set and is not an array of tables", last.name)}
+		}
+		m.value.items = append(m.value.items, item)
+		return item, nil
+	}
+	arr := &node{kind: kindArray, line: last.line, col: last.col, items: []*node{item}}
+	t.members = append(t.members, member{key: last.name, line: last.line, col: last.col, value: arr})
+	return item, nil
+}
+
+// keyValue sets a possibly dotted key inside t.
+func (r *tomlReader) keyValue(t *node, e *unstable.Node) error {
+	keys := r.keys(e)
+	for _, k := range keys[:len(keys)-1] {
+		var err error
+		if t, err = child(t, k); err != nil {
+			return err
+		}
+	}
+
+	last := keys[len(keys)-1]
+	val, err := r.value(e.Value(), last.line, last.col)
+	if err != nil {
+		return err
+	}
+	return t.add(member{key: last.name, line: last.line, col: last.col, value: val})
+}
+
+// value converts a TOML value. Arrays have no position of their own and
+// take the one of their key.
+func (r *tomlReader) value(v *unstable.Node, line, col int) (*node, error) {
+	if v.Raw.Length > 0 {
+		line, col = r.pos(v)
+	}
+	n := &node{line: line, col: col, text: string(v.Data)}
+
+	switch v.Kind {
+	case unstable.String:
+		n.kind = kindString
+	case unstable.Integer, unstable.Float:
+		n.kind = kindNumber
+	case unstable.Bool:
+		n.kind = kindBool
+	case unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		n.kind = kindDate
+	case unstable.Array:
+		n.kind, n.text = kindArray, ""
+		it := v.Children()
+		for it.Next() {
+			if it.Node().Kind == unstable.Comment {
+				continue
+			}
+			item, err := r.value(it.Node(), line, col)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+	case unstable.InlineTable:
+		n.kind, n.text = kindObject, ""
+		it := v.Children()
+		for it.Next() {
+			if it.Node().Kind != unstable.KeyValue {
+				continue
+			}
+			if err := r.keyValue(n, it.Node()); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, &ParseError{Line: line, Col: col, Msg: fmt.Sprintf("unsupported TOML value %s", v.Kind)}
+	}
+	return n, nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity ranks a validation issue.
+type Severity int
+
+const (
+	// Warning marks config that works but probably not as intended.
+	Warning Severity = iota
+	// Error marks entries that can never take effect or break a run.
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue is a single problem found by Validate.
+type Issue struct {
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+}
+
+// Validate checks the config for entries that are ignored, ambiguous or
+// clash with the file system. When root is not empty, category names are
+// also checked against existing non-directory entries in root.
+func (c *Config) Validate(root string) []Issue {
+	var issues []Issue
+	report := func(sev Severity, format string, args ...any) {
+		issues = append(issues, Issue{Severity: sev, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, dup := range c.duplicateKeys {
+		report(Warning, "%s; the last value is used", dup)
+	}
+
+	names := c.CategoryNames()
+
+	// Categories that rules or the MIME table can route files to
+	referenced := make(map[string]struct{})
+	for _, r := range c.Rules {
+		referenced[r.Category] = struct{}{}
+	}
+	for _, cat := range c.MIME {
+		referenced[cat] = struct{}{}
+	}
+
+	// Extension categories, in precedence order
+	owner := make(map[string]string)
+	for _, cat := range names {
+		entry, ok := c.Categories[cat]
+		if !ok {
+			continue
+		}
+		exts := entry.Ext
+		if cat == "mix" {
+			report(Error, "category %q is reserved for files no category matches", cat)
+		}
+		if _, ok := referenced[cat]; !ok && len(exts) == 0 {
+			report(Warning, "category %q lists no extensions", cat)
+		}
+		for _, ext := range exts {
+			lower := strings.ToLower(ext)
+			if !strings.HasPrefix(lower, ".") || lower == "." {
+				report(Error, "category %q: extension %q has no leading dot and never matches (did you mean %q?)",
+					cat, ext, "."+strings.TrimPrefix(lower, "."))
+				continue
+			}
+			if prev, dup := owner[lower]; dup {
+				if prev == cat {
+					report(Warning, "category %q lists %q more than once", cat, ext)
+				} else {
+					report(Warning, "extension %q is listed by %q and %q; %q takes precedence", ext, prev, cat, prev)
+				}
+				continue
+			}
+			owner[lower] = cat
+		}
+	}
+
+	for i, r := range c.Rules {
+		for _, ext := range r.Ext {
+			if !strings.HasPrefix(ext, ".") {
+				report(Error, "rule %d: extension %q has no leading dot and never matches", i+1, ext)
+			}
+		}
+	}
+
+	for i, sc := range c.Sidecars {
+		for _, ext := range append(append([]string{}, sc.Ext...), sc.Primary...) {
+			if !strings.HasPrefix(ext, ".") {
+				report(Error, "sidecar %d: extension %q has no leading dot and never matches", i+1, ext)
+			}
+		}
+	}
+
+	mimes := make([]string, 0, len(c.MIME))
+	for mime := range c.MIME {
+		mimes = append(mimes, mime)
+	}
+	sort.Strings(mimes)
+	for _, mime := range mimes {
+		if !strings.Contains(mime, "/") {
+			report(Error, "mime %q is not a type/subtype pair and never matches", mime)
+		}
+	}
+
+	if root != "" {
+		for _, cat := range names {
+			info, err := os.Lstat(filepath.Join(root, cat))
+			if err == nil && !info.IsDir() {
+				report(Error, "category %q collides with existing file %s", cat, filepath.Join(root, cat))
+			}
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+func readYAML(data []byte) (*node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		// yaml.v3 errors already name the line ("yaml: line 3: ...")
+		return nil, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		// Empty file
+		return &node{kind: kindNull, line: 1, col: 1}, nil
+	}
+	return fromYAML(doc.Content[0])
+}
+
+func fromYAML(y *yaml.Node) (*node, error) {
+	n := &node{line: y.Line, col: y.Column}
+
+	switch y.Kind {
+	case yaml.AliasNode:
+		return fromYAML(y.Alias)
+	case yaml.MappingNode:
+		n.kind = kindObject
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			k, v := y.Content[i], y.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				return nil, &ParseError{Line: k.Line, Col: k.Column, Msg: "keys must be plain strings"}
+			}
+			if k.Tag == "!!merge" {
+				return nil, &ParseError{Line: k.Line, Col: k.Column, Msg: "merge keys (<<) are not supported"}
+			}
+			val, err := fromYAML(v)
+			if err != nil {
+				return nil, err
+			}
+			if err := n.add(member{key: k.Value, line: k.Line, col: k.Column, value: val}); err != nil {
+				return nil, err
+			}
+		}
+	case yaml.SequenceNode:
+		n.kind = kindArray
+		for _, item := range y.Content {
+			val, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, val)
+		}
+	case yaml.ScalarNode:
+		n.text = y.Value
+		switch y.ShortTag() {
+		case "!!null":
+			n.kind = kindNull
+		case "!!bool":
+			n.kind = kindBool
+		case "!!int", "!!float":
+			n.kind = kindNumber
+		case "!!timestamp":
+			n.kind = kindDate
+		default:
+			n.kind = kindString
+		}
+	default:
+		return nil, errors.New("yaml: unsupported document")
+	}
+	return n, nil
+}
@@ -0,0 +1,431 @@
+// Package exif reads the few EXIF fields fileater organizes photos by from
+// JPEG, TIFF-based and HEIC files.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/riccione/fileater/internal/bmff"
+)
+
+// ErrNoExif is returned when a file has no readable EXIF block.
+var ErrNoExif = errors.New("no EXIF data")
+
+// Info holds the EXIF fields fileater uses.
+type Info struct {
+	// DateTimeOriginal is when the photo was taken, in local time since
+	// EXIF timestamps carry no zone. Zero if the tag is missing.
+	DateTimeOriginal time.Time
+	Make             string
+	Model            string
+	// Orientation is the EXIF orientation tag (1-8), 0 if missing.
+	Orientation int
+}
+
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+
+	// maxIFDEntries guards against corrupt files claiming huge directories
+	maxIFDEntries = 1024
+	// maxMetaBox bounds how much of a HEIF item info or location box is
+	// read; real ones are a few kilobytes
+	maxMetaBox = 1 << 20
+)
+
+// ReadFile extracts EXIF data from the file at path.
+func ReadFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, fi.Size())
+}
+
+// Read extracts EXIF data from r, which holds size bytes.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		tiff, err := jpegExif(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(tiff)
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return parseTIFF(io.NewSectionReader(r, 0, size))
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		tiff, err := heifExif(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(tiff)
+	}
+	return nil, ErrNoExif
+}
+
+// jpegExif walks the JPEG markers up to the image data looking for the
+// APP1 segment that carries the TIFF-structured EXIF block.
+func jpegExif(r io.ReaderAt, size int64) (*io.SectionReader, error) {
+	off := int64(2)
+	hdr := make([]byte, 4)
+	for off+4 <= size {
+		if _, err := r.ReadAt(hdr, off); err != nil {
+			return nil, err
+		}
+		if hdr[0] != 0xFF {
+			return nil, ErrNoExif
+		}
+		marker := hdr[1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			// Standalone markers and fill bytes carry no length
+			off += 2
+			if marker == 0xFF {
+				off--
+			}
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan: metadata segments come before it
+			return nil, ErrNoExif
+		}
+
+		segLen := int64(binary.BigEndian.Uint16(hdr[2:]))
+		if segLen < 2 {
+			return nil, ErrNoExif
+		}
+		if marker == 0xE1 && segLen >= 8 {
+			sig := make([]byte, 6)
+			if _, err := r.ReadAt(sig, off+4); err != nil {
+				return nil, err
+			}
+			if string(sig) == "Exif\x00\x00" {
+				return io.NewSectionReader(r, off+10, segLen-8), nil
+			}
+		}
+		off += 2 + segLen
+	}
+	return nil, ErrNoExif
+}
+
+// heifExif locates the "Exif" item of a HEIF/HEIC file through the item
+// info (iinf) and item location (iloc) boxes inside the top-level meta box.
+func heifExif(r io.ReaderAt, size int64) (*io.SectionReader, error) {
+	meta, err := bmff.Find(r, 0, size, "meta")
+	if err != nil {
+		return nil, ErrNoExif
+	}
+	// meta is a full box: skip version and flags
+	childStart, childEnd := meta.Start+4, meta.End()
+
+	iinf, err := bmff.Find(r, childStart, childEnd, "iinf")
+	if err != nil {
+		return nil, ErrNoExif
+	}
+	itemID, err := exifItemID(r, iinf)
+	if err != nil {
+		return nil, err
+	}
+
+	iloc, err := bmff.Find(r, childStart, childEnd, "iloc")
+	if err != nil {
+		return nil, ErrNoExif
+	}
+	itemOff, itemLen, err := itemLocation(r, iloc, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if itemOff < 0 || itemLen < 4 || itemLen > size-itemOff {
+		return nil, ErrNoExif
+	}
+
+	// The item starts with the offset of the TIFF header past these 4 bytes
+	prefix := make([]byte, 4)
+	if _, err := r.ReadAt(prefix, itemOff); err != nil {
+		return nil, err
+	}
+	skip := int64(binary.BigEndian.Uint32(prefix))
+	if 4+skip >= itemLen {
+		return nil, ErrNoExif
+	}
+	return io.NewSectionReader(r, itemOff+4+skip, itemLen-4-skip), nil
+}
+
+func exifItemID(r io.ReaderAt, iinf bmff.Box) (uint32, error) {
+	if iinf.Size > maxMetaBox {
+		return 0, ErrNoExif
+	}
+	buf := make([]byte, iinf.Size)
+	if _, err := r.ReadAt(buf, iinf.Start); err != nil {
+		return 0, err
+	}
+	if len(buf) < 6 {
+		return 0, ErrNoExif
+	}
+	p := 4
+	if buf[0] == 0 {
+		p += 2
+	} else {
+		p += 4
+	}
+
+	br := bytes.NewReader(buf)
+	for int64(p)+8 <= int64(len(buf)) {
+		b, err := bmff.ReadBox(br, int64(p), int64(len(buf)))
+		if err != nil {
+			return 0, err
+		}
+		if b.Type == "infe" && b.Size >= 4 && b.End() <= int64(len(buf)) {
+			e := buf[b.Start:b.End()]
+			version := e[0]
+			var id uint32
+			var typOff int
+			switch {
+			case version == 2 && len(e) >= 12:
+				id = uint32(binary.BigEndian.Uint16(e[4:]))
+				typOff = 8
+			case version >= 3 && len(e) >= 14:
+				id = binary.BigEndian.Uint32(e[4:])
+				typOff = 10
+			}
+			if typOff > 0 && string(e[typOff:typOff+4]) == "Exif" {
+				return id, nil
+			}
+		}
+		p = int(b.Next)
+	}
+	return 0, ErrNoExif
+}
+
+func itemLocation(r io.ReaderAt, iloc bmff.Box, itemID uint32) (int64, int64, error) {
+	if iloc.Size > maxMetaBox {
+		return 0, 0, ErrNoExif
+	}
+	buf := make([]byte, iloc.Size)
+	if _, err := r.ReadAt(buf, iloc.Start); err != nil {
+		return 0, 0, err
+	}
+	rd := &byteReader{buf: buf}
+
+	version := rd.uint(1)
+	rd.skip(3) // flags
+	sizes := rd.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = rd.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0x0F)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	var count uint64
+	if version < 2 {
+		count = rd.uint(2)
+	} else {
+		count = rd.uint(4)
+	}
+
+	for i := uint64(0); i < count && rd.err == nil; i++ {
+		var id uint64
+		if version < 2 {
+			id = rd.uint(2)
+		} else {
+			id = rd.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = rd.uint(2) & 0x0F
+		}
+		rd.skip(2) // data_reference_index
+		base := rd.uint(baseOffsetSize)
+		extents := rd.uint(2)
+
+		var first, total uint64
+		for e := uint64(0); e < extents && rd.err == nil; e++ {
+			rd.uint(indexSize)
+			extOff := rd.uint(offsetSize)
+			extLen := rd.uint(lengthSize)
+			if e == 0 {
+				first = extOff
+			}
+			total += extLen
+		}
+
+		if uint32(id) == itemID {
+			if rd.err != nil || method != 0 || extents != 1 {
+				// Items stored in idat or split across extents are rare for Exif
+				return 0, 0, ErrNoExif
+			}
+			return int64(base + first), int64(total), nil
+		}
+	}
+	return 0, 0, ErrNoExif
+}
+
+// byteReader reads big-endian integers of variable width from a buffer,
+// remembering the first out-of-range read.
+type byteReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (b *byteReader) uint(n int) uint64 {
+	if b.err != nil || n == 0 {
+		return 0
+	}
+	if b.pos+n > len(b.buf) {
+		b.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	var v uint64
+	for _, c := range b.buf[b.pos : b.pos+n] {
+		v = v<<8 | uint64(c)
+	}
+	b.pos += n
+	return v
+}
+
+func (b *byteReader) skip(n int) {
+	b.uint(n)
+}
+
+// parseTIFF reads IFD0 and the EXIF sub-IFD of a TIFF-structured block.
+func parseTIFF(r *io.SectionReader) (*Info, error) {
+	hdr := make([]byte, 8)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, ErrNoExif
+	}
+
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	if order.Uint16(hdr[2:]) != 42 {
+		return nil, ErrNoExif
+	}
+
+	t := &tiffReader{r: r, order: order}
+	info := &Info{}
+
+	ifd0, err := t.readIFD(int64(order.Uint32(hdr[4:])))
+	if err != nil {
+		return nil, err
+	}
+	info.Make = t.ascii(ifd0[tagMake])
+	info.Model = t.ascii(ifd0[tagModel])
+	info.Orientation = int(t.short(ifd0[tagOrientation]))
+	dateTime := t.ascii(ifd0[tagDateTime])
+
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if exifIFD, err := t.readIFD(int64(t.long(e))); err == nil {
+			if original := t.ascii(exifIFD[tagDateTimeOriginal]); original != "" {
+				dateTime = original
+			}
+		}
+	}
+
+	if ts, err := time.ParseInLocation("2006:01:02 15:04:05", dateTime, time.Local); err == nil {
+		info.DateTimeOriginal = ts
+	}
+	return info, nil
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte // the raw 4-byte value/offset field
+}
+
+type tiffReader struct {
+	r     *io.SectionReader
+	order binary.ByteOrder
+}
+
+func (t *tiffReader) readIFD(off int64) (map[uint16]ifdEntry, error) {
+	cnt := make([]byte, 2)
+	if _, err := t.r.ReadAt(cnt, off); err != nil {
+		return nil, ErrNoExif
+	}
+	n := int(t.order.Uint16(cnt))
+	if n > maxIFDEntries {
+		return nil, ErrNoExif
+	}
+
+	raw := make([]byte, n*12)
+	if _, err := t.r.ReadAt(raw, off+2); err != nil {
+		return nil, ErrNoExif
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		e := raw[i*12 : i*12+12]
+		entries[t.order.Uint16(e)] = ifdEntry{
+			typ:   t.order.Uint16(e[2:]),
+			count: t.order.Uint32(e[4:]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// ascii decodes an ASCII (type 2) entry, stored inline when <= 4 bytes.
+func (t *tiffReader) ascii(e ifdEntry) string {
+	if e.typ != 2 || e.count == 0 || e.count > 1024 {
+		return ""
+	}
+	data := e.value
+	if e.count > 4 {
+		data = make([]byte, e.count)
+		if _, err := t.r.ReadAt(data, int64(t.order.Uint32(e.value))); err != nil {
+			return ""
+		}
+	}
+	s := string(data[:min(int(e.count), len(data))])
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// short decodes a SHORT (type 3) entry.
+func (t *tiffReader) short(e ifdEntry) uint16 {
+	if e.typ != 3 || e.count == 0 {
+		return 0
+	}
+	return t.order.Uint16(e.value)
+}
+
+// long decodes a LONG (type 4) or IFD (type 13) entry.
+func (t *tiffReader) long(e ifdEntry) uint32 {
+	if (e.typ != 4 && e.typ != 13) || e.count == 0 {
+		return 0
+	}
+	return t.order.Uint32(e.value)
+}
@@ -0,0 +1,238 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildTIFF assembles a minimal TIFF block with Make, Model, Orientation
+// and an EXIF sub-IFD holding DateTimeOriginal.
+func buildTIFF(order binary.ByteOrder, camMake, model, taken string, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+	makeB, modelB, takenB := ascii(camMake), ascii(model), ascii(taken)
+
+	// IFD0 at 8 with 4 entries, EXIF IFD right after it with 1 entry,
+	// then the out-of-line string values
+	ifd0Len := 2 + 4*12 + 4
+	exifOff := 8 + ifd0Len
+	exifLen := 2 + 1*12 + 4
+	dataOff := exifOff + exifLen
+
+	entry := func(tag, typ uint16, count uint32, value uint32) {
+		binary.Write(&buf, order, tag)
+		binary.Write(&buf, order, typ)
+		binary.Write(&buf, order, count)
+		if typ == 3 {
+			binary.Write(&buf, order, uint16(value))
+			binary.Write(&buf, order, uint16(0))
+		} else {
+			binary.Write(&buf, order, value)
+		}
+	}
+
+	makeOff := dataOff
+	modelOff := makeOff + len(makeB)
+	takenOff := modelOff + len(modelB)
+
+	binary.Write(&buf, order, uint16(4))
+	entry(tagMake, 2, uint32(len(makeB)), uint32(makeOff))
+	entry(tagModel, 2, uint32(len(modelB)), uint32(modelOff))
+	entry(tagOrientation, 3, 1, uint32(orientation))
+	entry(tagExifIFD, 4, 1, uint32(exifOff))
+	binary.Write(&buf, order, uint32(0))
+
+	binary.Write(&buf, order, uint16(1))
+	entry(tagDateTimeOriginal, 2, uint32(len(takenB)), uint32(takenOff))
+	binary.Write(&buf, order, uint32(0))
+
+	buf.Write(makeB)
+	buf.Write(modelB)
+	buf.Write(takenB)
+	return buf.Bytes()
+}
+
+func buildJPEG(tiff []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+	// A JFIF APP0 segment before the EXIF one, as cameras often write
+	buf.Write([]byte{0xFF, 0xE0, 0x00, 0x10})
+	buf.WriteString("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	buf.Write([]byte{0xFF, 0xE1})
+	binary.Write(&buf, binary.BigEndian, uint16(2+6+len(tiff)))
+	buf.WriteString("Exif\x00\x00")
+	buf.Write(tiff)
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func isoBox(typ string, payload []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(8+len(payload)))
+	buf.WriteString(typ)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func buildHEIC(tiff []byte) []byte {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	var infe bytes.Buffer
+	infe.Write([]byte{2, 0, 0, 0})
+	binary.Write(&infe, binary.BigEndian, uint16(7)) // item_ID
+	binary.Write(&infe, binary.BigEndian, uint16(0)) // protection index
+	infe.WriteString("Exif")
+	infe.WriteString("\x00")
+
+	var iinf bytes.Buffer
+	iinf.Write([]byte{0, 0, 0, 0})
+	binary.Write(&iinf, binary.BigEndian, uint16(1))
+	iinf.Write(isoBox("infe", infe.Bytes()))
+
+	exifItem := append([]byte{0, 0, 0, 6}, []byte("Exif\x00\x00")...)
+	exifItem = append(exifItem, tiff...)
+
+	// iloc is sized before the offset is known, so build it twice
+	build := func(itemOff uint32) []byte {
+		var iloc bytes.Buffer
+		iloc.Write([]byte{0, 0, 0, 0})
+		iloc.Write([]byte{0x44, 0x00}) // 4-byte offsets and lengths, no base offset
+		binary.Write(&iloc, binary.BigEndian, uint16(1))
+		binary.Write(&iloc, binary.BigEndian, uint16(7))
+		binary.Write(&iloc, binary.BigEndian, uint16(0))
+		binary.Write(&iloc, binary.BigEndian, uint16(1))
+		binary.Write(&iloc, binary.BigEndian, itemOff)
+		binary.Write(&iloc, binary.BigEndian, uint32(len(exifItem)))
+
+		meta := append([]byte{0, 0, 0, 0}, isoBox("hdlr", make([]byte, 24))...)
+		meta = append(meta, isoBox("iinf", iinf.Bytes())...)
+		meta = append(meta, isoBox("iloc", iloc.Bytes())...)
+		return isoBox("meta", meta)
+	}
+	meta := build(0)
+	mdatHeader := 8
+	itemOff := uint32(len(ftyp) + len(meta) + mdatHeader)
+	meta = build(itemOff)
+
+	out := append(ftyp, meta...)
+	return append(out, isoBox("mdat", exifItem)...)
+}
+
+func TestRead(t *testing.T) {
+	want := time.Date(2024, time.June, 12, 14, 35, 1, 0, time.Local)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"JPEG Little Endian", buildJPEG(buildTIFF(binary.LittleEndian, "Canon", "EOS R6", "2024:06:12 14:35:01", 6))},
+		{"JPEG Big Endian", buildJPEG(buildTIFF(binary.BigEndian, "Canon", "EOS R6", "2024:06:12 14:35:01", 6))},
+		{"TIFF", buildTIFF(binary.LittleEndian, "Canon", "EOS R6", "2024:06:12 14:35:01", 6)},
+		{"HEIC", buildHEIC(buildTIFF(binary.BigEndian, "Canon", "EOS R6", "2024:06:12 14:35:01", 6))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Read(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if !info.DateTimeOriginal.Equal(want) {
+				t.Errorf("DateTimeOriginal = %v; want %v", info.DateTimeOriginal, want)
+			}
+			if info.Make != "Canon" || info.Model != "EOS R6" {
+				t.Errorf("camera = %q %q; want Canon EOS R6", info.Make, info.Model)
+			}
+			if info.Orientation != 6 {
+				t.Errorf("Orientation = %d; want 6", info.Orientation)
+			}
+		})
+	}
+}
+
+func TestRead_NoExif(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"JPEG Without APP1", []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00")},
+		{"Truncated TIFF", []byte("II*\x00\xFF\x00\x00\x00")},
+		{"Empty", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Error("expected error for file without EXIF")
+			}
+		})
+	}
+}
+
+func TestRead_MalformedHEIC(t *testing.T) {
+	heic := buildHEIC(buildTIFF(binary.BigEndian, "Canon", "EOS R6", "2024:06:12 14:35:01", 6))
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	// the iloc box ends with the item's 4-byte offset and length
+	meta := bytes.Index(heic, []byte("meta")) - 4
+	metaEnd := meta + int(binary.BigEndian.Uint32(heic[meta:]))
+	pastEnd := bytes.Clone(heic)
+	binary.BigEndian.PutUint32(pastEnd[metaEnd-8:], 0xFFFFFFF0)
+
+	// a huge iinf claiming a 64-bit size near the limit of int64
+	var hugeIinf []byte
+	hugeIinf = binary.BigEndian.AppendUint32(hugeIinf, 1)
+	hugeIinf = append(hugeIinf, "iinf"...)
+	hugeIinf = binary.BigEndian.AppendUint64(hugeIinf, 1<<63-4)
+	overflow := append(bytes.Clone(ftyp), isoBox("meta", append([]byte{0, 0, 0, 0}, hugeIinf...))...)
+
+	// an iinf larger than any real one
+	oversized := append(bytes.Clone(ftyp), isoBox("meta", append([]byte{0, 0, 0, 0}, isoBox("iinf", make([]byte, 2<<20))...))...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Truncated", heic[:len(heic)/2]},
+		{"Item Past End", pastEnd},
+		{"Overflowing Box Size", overflow},
+		{"Oversized Item Info", oversized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Error("expected error for malformed HEIC")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	data := buildJPEG(buildTIFF(binary.LittleEndian, "NIKON", "Z 6", "2021:01:02 03:04:05", 1))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if info.Make != "NIKON" || info.DateTimeOriginal.Year() != 2021 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
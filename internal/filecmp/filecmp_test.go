@@ -0,0 +1,52 @@
+package filecmp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a")
+	b := filepath.Join(tmpDir, "b")
+	c := filepath.Join(tmpDir, "c")
+	d := filepath.Join(tmpDir, "d")
+	os.WriteFile(a, bytes.Repeat([]byte("ab"), 40000), 0644)
+	os.WriteFile(b, bytes.Repeat([]byte("ab"), 40000), 0644)
+	os.WriteFile(c, append(bytes.Repeat([]byte("ab"), 40000), 'c'), 0644)
+	os.WriteFile(d, append(bytes.Repeat([]byte("ab"), 39999), "ba"...), 0644)
+
+	if same, err := SameContent(a, b); !same || err != nil {
+		t.Errorf("SameContent(a, b) = %v, %v; want true", same, err)
+	}
+	if same, err := SameContent(a, c); same || err != nil {
+		t.Errorf("SameContent(a, c) = %v, %v; want false", same, err)
+	}
+	if same, err := SameContent(a, d); same || err != nil {
+		t.Errorf("SameContent(a, d) = %v, %v; want false", same, err)
+	}
+	if _, err := SameContent(a, filepath.Join(tmpDir, "missing")); err == nil {
+		t.Error("SameContent with a missing file should fail")
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a")
+	b := filepath.Join(tmpDir, "b")
+	link := filepath.Join(tmpDir, "link")
+	os.WriteFile(a, []byte("same"), 0644)
+	os.WriteFile(b, []byte("same"), 0644)
+	if err := os.Link(a, link); err != nil {
+		t.Skipf("hardlinks unavailable: %v", err)
+	}
+
+	if same, err := SameFile(a, link); !same || err != nil {
+		t.Errorf("SameFile(a, link) = %v, %v; want true", same, err)
+	}
+	if same, err := SameFile(a, b); same || err != nil {
+		t.Errorf("SameFile(a, b) = %v, %v; want false", same, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package hashcache
+
+import "io/fs"
+
+// fileID is not available here; files are keyed by path instead.
+func fileID(info fs.FileInfo) (uint64, uint64, bool) {
+	return 0, 0, false
+}
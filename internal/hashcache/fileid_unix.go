@@ -0,0 +1,17 @@
+//go:build unix
+
+package hashcache
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and inode number of a file.
+func fileID(info fs.FileInfo) (uint64, uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
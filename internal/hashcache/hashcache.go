@@ -0,0 +1,191 @@
+// Package hashcache remembers file checksums between runs so unchanged
+// files are not read again. Entries are keyed by device and inode, which
+// survive the renames the organizer makes, and are only trusted while the
+// file's size and modification time are the same as when it was hashed.
+package hashcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileName is the cache file kept in the root with --hash-cache root.
+const FileName = ".fileater-hashes.json"
+
+// version is the format of the cache file; other versions are discarded.
+const version = 1
+
+// Entry is what the cache knows about one file.
+type Entry struct {
+	// Path is where the file was last seen.
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	// Sums maps a checksum kind, e.g. "sha256", to its hex value.
+	Sums map[string]string `json:"sums"`
+}
+
+type file struct {
+	Version int               `json:"version"`
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Cache is a set of checksums loaded from and saved to one file.
+type Cache struct {
+	path    string
+	entries map[string]*Entry
+	dirty   bool
+}
+
+// DefaultPath returns the per-user cache file, fileater/hashes.json in the
+// user cache directory ($XDG_CACHE_HOME or ~/.cache on Linux).
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fileater", "hashes.json"), nil
+}
+
+// Open loads the cache file at path. A missing file gives an empty cache,
+// as does one written in another format version.
+func Open(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: make(map[string]*Entry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash cache: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse hash cache %s: %w", path, err)
+	}
+	if f.Version == version && f.Entries != nil {
+		c.entries = f.Entries
+	}
+	return c, nil
+}
+
+// Path returns the file the cache is saved to.
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Len returns the number of cached files.
+func (c *Cache) Len() int {
+	return len(c.entries)
+}
+
+// Lookup returns the checksum of the given kind for the file at path with
+// the given info, if it was stored while the file looked the same.
+func (c *Cache) Lookup(path string, info fs.FileInfo, kind string) (string, bool) {
+	e, ok := c.entries[key(path, info)]
+	if !ok || !e.matches(info) {
+		return "", false
+	}
+	sum, ok := e.Sums[kind]
+	if ok && e.Path != path {
+		// the file was moved or linked; remember where it is now
+		e.Path = path
+		c.dirty = true
+	}
+	return sum, ok
+}
+
+// Store records a checksum of the given kind for the file at path. Sums of
+// other kinds are kept while the file is unchanged and dropped otherwise.
+func (c *Cache) Store(path string, info fs.FileInfo, kind, sum string) {
+	k := key(path, info)
+	e, ok := c.entries[k]
+	if !ok || !e.matches(info) {
+		e = &Entry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Sums: make(map[string]string)}
+		c.entries[k] = e
+	}
+	e.Path = path
+	e.Sums[kind] = sum
+	c.dirty = true
+}
+
+// Prune drops the entries whose file no longer exists or has changed since
+// it was hashed, and returns how many were dropped.
+func (c *Cache) Prune() int {
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pruned := 0
+	for _, k := range keys {
+		e := c.entries[k]
+		info, err := os.Stat(e.Path)
+		if err == nil && info.Mode().IsRegular() && key(e.Path, info) == k && e.matches(info) {
+			continue
+		}
+		delete(c.entries, k)
+		pruned++
+	}
+	if pruned > 0 {
+		c.dirty = true
+	}
+	return pruned
+}
+
+// Save writes the cache back to its file if anything changed, replacing
+// the old file atomically so an interrupted save leaves it intact.
+func (c *Cache) Save() error {
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(file{Version: version, Entries: c.entries})
+	if err != nil {
+		return fmt.Errorf("failed to marshal hash cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create hash cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// matches reports whether info still describes the file that was hashed.
+func (e *Entry) matches(info fs.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// key identifies a file by device and inode where the platform exposes
+// them, and by its absolute path otherwise.
+func key(path string, info fs.FileInfo) string {
+	if dev, ino, ok := fileID(info); ok {
+		return fmt.Sprintf("%d:%d", dev, ino)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "path:" + path
+}
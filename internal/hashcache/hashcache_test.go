@@ -0,0 +1,118 @@
+package hashcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache_StoreLookupSave(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(file, []byte("hello"), 0644)
+	info, _ := os.Stat(file)
+
+	cachePath := filepath.Join(tmpDir, "cache", "hashes.json")
+	c, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	c.Store(file, info, "sha256", "abc")
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	c, err = Open(cachePath)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if sum, ok := c.Lookup(file, info, "sha256"); !ok || sum != "abc" {
+		t.Errorf("Lookup = %q, %v; want abc", sum, ok)
+	}
+	if _, ok := c.Lookup(file, info, "other"); ok {
+		t.Error("a kind that was never stored must not be found")
+	}
+}
+
+func TestCache_InvalidatedByChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(file, []byte("hello"), 0644)
+	info, _ := os.Stat(file)
+
+	c, _ := Open(filepath.Join(tmpDir, FileName))
+	c.Store(file, info, "sha256", "abc")
+
+	later := info.ModTime().Add(time.Hour)
+	os.Chtimes(file, later, later)
+	touched, _ := os.Stat(file)
+	if _, ok := c.Lookup(file, touched, "sha256"); ok {
+		t.Error("a changed modification time must invalidate the entry")
+	}
+
+	os.WriteFile(file, []byte("hello, world"), 0644)
+	os.Chtimes(file, info.ModTime(), info.ModTime())
+	grown, _ := os.Stat(file)
+	if _, ok := c.Lookup(file, grown, "sha256"); ok {
+		t.Error("a changed size must invalidate the entry")
+	}
+}
+
+func TestCache_FollowsRenames(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(file, []byte("hello"), 0644)
+	info, _ := os.Stat(file)
+
+	c, _ := Open(filepath.Join(tmpDir, FileName))
+	c.Store(file, info, "sha256", "abc")
+
+	moved := filepath.Join(tmpDir, "b.txt")
+	os.Rename(file, moved)
+	info, _ = os.Stat(moved)
+	if _, _, ok := fileID(info); !ok {
+		t.Skip("files are keyed by path on this platform")
+	}
+	if sum, ok := c.Lookup(moved, info, "sha256"); !ok || sum != "abc" {
+		t.Errorf("Lookup after rename = %q, %v; want abc", sum, ok)
+	}
+	if c.Prune() != 0 {
+		t.Error("the entry follows the renamed file and must survive pruning")
+	}
+}
+
+func TestCache_Prune(t *testing.T) {
+	tmpDir := t.TempDir()
+	keep := filepath.Join(tmpDir, "keep.txt")
+	gone := filepath.Join(tmpDir, "gone.txt")
+	os.WriteFile(keep, []byte("keep"), 0644)
+	os.WriteFile(gone, []byte("gone"), 0644)
+	keepInfo, _ := os.Stat(keep)
+	goneInfo, _ := os.Stat(gone)
+
+	c, _ := Open(filepath.Join(tmpDir, FileName))
+	c.Store(keep, keepInfo, "sha256", "k")
+	c.Store(gone, goneInfo, "sha256", "g")
+	os.Remove(gone)
+
+	if pruned := c.Prune(); pruned != 1 {
+		t.Errorf("Prune = %d, want 1", pruned)
+	}
+	if _, ok := c.Lookup(keep, keepInfo, "sha256"); !ok {
+		t.Error("the entry of an unchanged file must be kept")
+	}
+}
+
+func TestOpen_OtherVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	os.WriteFile(path, []byte(`{"version": 99, "entries": {"1:2": {"path": "x"}}}`), 0644)
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("entries of another format version must be discarded, got %d", c.Len())
+	}
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JournalName is the write-ahead journal of the run in progress in a root.
+// Every change is recorded in it before it is made and marked complete
+// after, so a run cut short by a crash can be finished or rolled back. It
+// is removed once the run has been appended to the history log.
+const JournalName = ".fileater-journal.jsonl"
+
+// Kinds of journaled operations.
+const (
+	OpMove      = "move"
+	OpMkdir     = "mkdir"
+	OpRmdir     = "rmdir"
+	OpDuplicate = "duplicate"
+)
+
+// Op is a change recorded in the journal.
+type Op struct {
+	Seq  int    `json:"seq"`
+	Kind string `json:"kind"`
+	// Src and Dst of a move; Mode is its transfer mode, SourceRoot the
+	// source directory the file was found in.
+	Src        string `json:"src,omitempty"`
+	Dst        string `json:"dst,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	SourceRoot string `json:"source_root,omitempty"`
+	// Path of a directory created or removed.
+	Path string `json:"path,omitempty"`
+	// Dup is what is about to happen to a duplicate; once done, what did.
+	Dup *Duplicate `json:"dup,omitempty"`
+
+	// Done is set when the operation was marked complete, Err when it
+	// failed without changing anything.
+	Done bool   `json:"-"`
+	Err  string `json:"-"`
+}
+
+// journalLine is one line of the journal: the run header, an operation
+// about to be made, or the completion of one.
+type journalLine struct {
+	Begin *Run      `json:"begin,omitempty"`
+	Op    *Op       `json:"op,omitempty"`
+	Done  *doneMark `json:"done,omitempty"`
+}
+
+type doneMark struct {
+	Seq int        `json:"seq"`
+	Dup *Duplicate `json:"dup,omitempty"`
+	// Error is set instead when the operation failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Journal writes the journal of a run in progress.
+type Journal struct {
+	f      *os.File
+	seq    int
+	failed int
+}
+
+// BeginJournal starts the journal of run in root. It fails when the
+// journal of an interrupted run is still there.
+func BeginJournal(root string, run *Run) (*Journal, error) {
+	path := filepath.Join(root, JournalName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("an interrupted run was found in %s; run \"fileater recover\" first", root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	j := &Journal{f: f}
+	if err := j.write(journalLine{Begin: run}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return j, nil
+}
+
+// Intend records an operation before it is made and returns its sequence
+// number for Done or Fail. The operation must not be made on an error.
+func (j *Journal) Intend(op Op) (int, error) {
+	j.seq++
+	op.Seq = j.seq
+	if err := j.write(journalLine{Op: &op}); err != nil {
+		j.failed++
+		return 0, err
+	}
+	return op.Seq, nil
+}
+
+// Done marks an operation complete. dup, if not nil, replaces the
+// duplicate recorded with the operation by what was actually done.
+func (j *Journal) Done(seq int, dup *Duplicate) error {
+	return j.write(journalLine{Done: &doneMark{Seq: seq, Dup: dup}})
+}
+
+// Fail records that an operation failed and left things as they were.
+func (j *Journal) Fail(seq int, err error) error {
+	j.failed++
+	return j.write(journalLine{Done: &doneMark{Seq: seq, Error: err.Error()}})
+}
+
+// Changed reports whether any operation was journaled that did not fail.
+func (j *Journal) Changed() bool {
+	return j.seq > j.failed
+}
+
+// Close closes the journal, leaving it on disk for recovery.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Commit closes the journal and removes it: the run is over.
+func (j *Journal) Commit() error {
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(j.f.Name())
+}
+
+func (j *Journal) write(line journalLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Interrupted is a run whose journal was left behind.
+type Interrupted struct {
+	// Run holds the run header; its State and Counts cover the completed
+	// operations only.
+	Run *Run
+	// Ops lists every operation in order, Done or not.
+	Ops []*Op
+}
+
+// Pending returns the operations that were started but never marked
+// complete or failed; their outcome has to be checked on disk.
+func (in *Interrupted) Pending() []*Op {
+	var pending []*Op
+	for _, op := range in.Ops {
+		if !op.Done && op.Err == "" {
+			pending = append(pending, op)
+		}
+	}
+	return pending
+}
+
+// ReadJournal reads the journal left in root by an interrupted run. It
+// returns nil and no error when there is none.
+func ReadJournal(root string) (*Interrupted, error) {
+	f, err := os.Open(filepath.Join(root, JournalName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	in := &Interrupted{}
+	bySeq := make(map[int]*Op)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var jl journalLine
+		if err := json.Unmarshal([]byte(line), &jl); err != nil {
+			if i == len(lines)-1 {
+				// a torn last line from the crash
+				break
+			}
+			return nil, fmt.Errorf("journal line %d: %w", i+1, err)
+		}
+		switch {
+		case jl.Begin != nil:
+			in.Run = jl.Begin
+		case jl.Op != nil:
+			in.Ops = append(in.Ops, jl.Op)
+			bySeq[jl.Op.Seq] = jl.Op
+		case jl.Done != nil:
+			if op, ok := bySeq[jl.Done.Seq]; ok {
+				if jl.Done.Error != "" {
+					op.Err = jl.Done.Error
+					continue
+				}
+				op.Done = true
+				if jl.Done.Dup != nil {
+					op.Dup = jl.Done.Dup
+				}
+			}
+		}
+	}
+	if in.Run == nil {
+		// the crash came before the header was written: nothing happened
+		in.Run = &Run{ID: "unknown"}
+	}
+	in.Run.Interrupted = true
+	in.Run.State = in.State()
+	in.Run.Counts = Counts{
+		Moved:       len(in.Run.State.MovedFiles),
+		Duplicates:  len(in.Run.State.Duplicates),
+		DeletedDirs: len(in.Run.State.DeletedDirs),
+	}
+	return in, nil
+}
+
+// State returns the history state of the completed operations, which is
+// what undo needs to reverse them.
+func (in *Interrupted) State() HistoryState {
+	state := in.Run.State
+	state.RunID = in.Run.ID
+	state.MovedFiles = make(map[string]string)
+	state.Sources = make(map[string]string)
+	state.Modes = make(map[string]string)
+	state.DeletedDirs = nil
+	state.CreatedDirs = nil
+	state.Duplicates = nil
+	for _, op := range in.Ops {
+		if !op.Done {
+			continue
+		}
+		switch op.Kind {
+		case OpMove:
+			state.MovedFiles[op.Dst] = op.Src
+			if op.SourceRoot != "" {
+				state.Sources[op.Dst] = op.SourceRoot
+			}
+			if op.Mode != "" && op.Mode != "move" {
+				state.Modes[op.Dst] = op.Mode
+			}
+		case OpMkdir:
+			state.CreatedDirs = append(state.CreatedDirs, op.Path)
+		case OpRmdir:
+			state.DeletedDirs = append(state.DeletedDirs, op.Path)
+		case OpDuplicate:
+			if op.Dup != nil {
+				state.Duplicates = append(state.Duplicates, *op.Dup)
+			}
+		}
+	}
+	return state
+}
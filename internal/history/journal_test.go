@@ -0,0 +1,76 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal_ReadInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	j, err := BeginJournal(dir, &Run{ID: "20260301-100000-abcd", Command: "organize", State: HistoryState{RootPath: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, _ := j.Intend(Op{Kind: OpMove, Src: "/r/a.txt", Dst: "/r/docs/a.txt", Mode: "move", SourceRoot: "/r"})
+	j.Done(moved, nil)
+	dup := &Duplicate{Action: "trash", Path: "/r/b.txt", KeptCopy: "/r/docs/a.txt"}
+	seq, _ := j.Intend(Op{Kind: OpDuplicate, Dup: dup})
+	j.Done(seq, &Duplicate{Action: "trash", Path: "/r/b.txt", KeptCopy: "/r/docs/a.txt", Stored: "/trash/b.txt"})
+	j.Intend(Op{Kind: OpMove, Src: "/r/c.pdf", Dst: "/r/docs/c.pdf"})
+	failed, _ := j.Intend(Op{Kind: OpRmdir, Path: "/r/old"})
+	j.Fail(failed, errors.New("directory not empty"))
+	j.Close()
+
+	if _, err := BeginJournal(dir, &Run{ID: "20260301-110000-abcd"}); err == nil {
+		t.Error("expected a new run to refuse while a journal is left")
+	}
+
+	in, err := ReadJournal(dir)
+	if err != nil || in == nil {
+		t.Fatalf("ReadJournal = %v, %v", in, err)
+	}
+	if !in.Run.Interrupted || in.Run.ID != "20260301-100000-abcd" {
+		t.Errorf("unexpected run: %+v", in.Run)
+	}
+	if pending := in.Pending(); len(pending) != 1 || pending[0].Src != "/r/c.pdf" {
+		t.Errorf("expected c.pdf pending, got %+v", pending)
+	}
+	if last := in.Ops[len(in.Ops)-1]; last.Done || last.Err != "directory not empty" {
+		t.Errorf("failed operation not recorded: %+v", last)
+	}
+	if len(in.Run.State.DeletedDirs) != 0 {
+		t.Error("a failed operation should not be in the state")
+	}
+	state := in.Run.State
+	if state.MovedFiles["/r/docs/a.txt"] != "/r/a.txt" || len(state.MovedFiles) != 1 {
+		t.Errorf("completed moves not in state: %v", state.MovedFiles)
+	}
+	if len(state.Duplicates) != 1 || state.Duplicates[0].Stored != "/trash/b.txt" {
+		t.Errorf("completed duplicate not in state: %+v", state.Duplicates)
+	}
+
+	// Load lists the interrupted run last
+	runs, err := Load(dir)
+	if err != nil || len(runs) != 1 || !runs[0].Interrupted {
+		t.Errorf("Load = %v, %v", runs, err)
+	}
+}
+
+func TestJournal_CommitRemoves(t *testing.T) {
+	dir := t.TempDir()
+	j, err := BeginJournal(dir, &Run{ID: "20260301-100000-abcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, JournalName)); !os.IsNotExist(err) {
+		t.Error("journal should be removed")
+	}
+	if in, err := ReadJournal(dir); in != nil || err != nil {
+		t.Errorf("ReadJournal = %v, %v", in, err)
+	}
+}
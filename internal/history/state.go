@@ -1,8 +1,68 @@
 package history
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"time"
+)
+
+// FileName is the history file written to the root after each run.
+const FileName = ".fileater-history.json"
+
+// QuarantineDir is the folder in the root that quarantined duplicates are
+// moved to, one subfolder per run ID.
+const QuarantineDir = ".fileater-quarantine"
+
+// LinkTempPrefix starts the name of the temporary hardlink that is renamed
+// over a duplicate replaced by a link to its kept copy.
+const LinkTempPrefix = ".fileater-link-"
+
 // HistoryState holds the state of a file organization run for undo/rollback.
 type HistoryState struct {
+	// RunID identifies the run, e.g. "20240131-180405-9f2c".
+	RunID       string            `json:"run_id,omitempty"`
 	MovedFiles  map[string]string `json:"moved_files"`
 	DeletedDirs []string          `json:"deleted_dirs"`
 	RootPath    string            `json:"root_path"`
+	// SourceRoots lists the directories that were scanned, when files were
+	// gathered from outside RootPath with --dest.
+	SourceRoots []string `json:"source_roots,omitempty"`
+	// Sources maps each current path in MovedFiles to the source directory
+	// it was found in.
+	Sources map[string]string `json:"sources,omitempty"`
+	// CreatedDirs lists directories the run created outside RootPath for
+	// categories with their own destination.
+	CreatedDirs []string `json:"created_dirs,omitempty"`
+	// Modes maps each current path in MovedFiles that was not simply moved
+	// to its transfer mode: "copy", "hardlink" or "symlink".
+	Modes map[string]string `json:"modes,omitempty"`
+	// Duplicates lists the duplicates the run set aside.
+	Duplicates []Duplicate `json:"duplicates,omitempty"`
+}
+
+// Duplicate records what a run did with a duplicate file.
+type Duplicate struct {
+	// Action is "quarantine", "trash" or "hardlink".
+	Action string `json:"action"`
+	// Path is where the duplicate was found.
+	Path string `json:"path"`
+	// KeptCopy is the file it duplicates.
+	KeptCopy string `json:"kept_copy"`
+	// Stored is where a quarantined or trashed duplicate is now.
+	Stored string `json:"stored,omitempty"`
+	// TrashInfo is the .trashinfo file of a trashed duplicate.
+	TrashInfo string `json:"trash_info,omitempty"`
+	// Mode and ModTime of a duplicate replaced by a hardlink, restored
+	// when undo gives it its own copy of the data again.
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	ModTime time.Time   `json:"mod_time,omitzero"`
+}
+
+// NewRunID returns an identifier for a run started at t: its UTC time
+// followed by a random suffix, so IDs sort by start time.
+func NewRunID(t time.Time) string {
+	var b [2]byte
+	rand.Read(b[:])
+	return t.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
 }
@@ -0,0 +1,273 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StoreName is the append-only history log in the root, holding one JSON
+// record per line for every run and every undo.
+const StoreName = ".fileater-history.jsonl"
+
+// LegacyRunID names the run found in a FileName history written by older
+// versions when it carries no run ID of its own.
+const LegacyRunID = "legacy"
+
+var runIDRe = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{4}$`)
+
+// IsRunID reports whether s looks like an ID made by NewRunID.
+func IsRunID(s string) bool {
+	return runIDRe.MatchString(s) || s == LegacyRunID
+}
+
+// Counts summarizes what a run did.
+type Counts struct {
+	Processed   int `json:"processed"`
+	Moved       int `json:"moved"`
+	Duplicates  int `json:"duplicates"`
+	DeletedDirs int `json:"deleted_dirs"`
+	Errors      int `json:"errors"`
+}
+
+// Run is one run recorded in the history log.
+type Run struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Version string    `json:"version,omitempty"`
+	// Command is "organize" or "dupes".
+	Command string `json:"command,omitempty"`
+	// Flags lists the command-line flags the run was started with.
+	Flags []string `json:"flags,omitempty"`
+	// ConfigDigest identifies the effective configuration; empty when the
+	// built-in categories were used.
+	ConfigDigest string       `json:"config_digest,omitempty"`
+	Counts       Counts       `json:"counts"`
+	State        HistoryState `json:"state"`
+
+	// UndoneAt is when the run was undone, zero if it was not.
+	UndoneAt time.Time `json:"-"`
+	// Legacy marks a run read from an older FileName history.
+	Legacy bool `json:"-"`
+	// Interrupted marks a run read from the journal it left behind.
+	Interrupted bool `json:"-"`
+}
+
+// Touched returns every path the run created, moved or removed a file at.
+func (r *Run) Touched() []string {
+	var paths []string
+	for current, original := range r.State.MovedFiles {
+		paths = append(paths, current, original)
+	}
+	for _, d := range r.State.Duplicates {
+		paths = append(paths, d.Path)
+		if d.Stored != "" {
+			paths = append(paths, d.Stored)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// record is one line of the history log.
+type record struct {
+	Run  *Run        `json:"run,omitempty"`
+	Undo *undoRecord `json:"undo,omitempty"`
+}
+
+type undoRecord struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// Append adds a run to the history log of root. The line is synced to
+// disk before Append returns.
+func Append(root string, run *Run) error {
+	return appendRecord(root, record{Run: run})
+}
+
+// MarkUndone records that the run with the given ID was undone.
+func MarkUndone(root, id string, t time.Time) error {
+	return appendRecord(root, record{Undo: &undoRecord{ID: id, Time: t}})
+}
+
+func appendRecord(root string, rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(root, StoreName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history log: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync history log: %w", err)
+	}
+	return f.Close()
+}
+
+// Load reads the runs recorded for root, oldest first. A FileName history
+// left by an older version comes first, marked Legacy, and a run that was
+// interrupted comes last, marked Interrupted. It returns no runs and no
+// error when there is no history at all.
+func Load(root string) ([]*Run, error) {
+	runs, err := loadLog(root)
+	if err != nil {
+		return nil, err
+	}
+	in, err := ReadJournal(root)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		runs = append(runs, in.Run)
+	}
+	return runs, nil
+}
+
+func loadLog(root string) ([]*Run, error) {
+	var runs []*Run
+
+	legacyPath := filepath.Join(root, FileName)
+	if data, err := os.ReadFile(legacyPath); err == nil {
+		var state HistoryState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse history file: %w", err)
+		}
+		run := &Run{ID: state.RunID, State: state, Legacy: true}
+		if run.ID == "" {
+			run.ID = LegacyRunID
+		}
+		if fi, err := os.Stat(legacyPath); err == nil {
+			run.Time = fi.ModTime()
+		}
+		run.Counts = Counts{Moved: len(state.MovedFiles), Duplicates: len(state.Duplicates), DeletedDirs: len(state.DeletedDirs)}
+		runs = append(runs, run)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	f, err := os.Open(filepath.Join(root, StoreName))
+	if errors.Is(err, os.ErrNotExist) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history log: %w", err)
+	}
+	defer f.Close()
+
+	byID := make(map[string]*Run)
+	for _, r := range runs {
+		byID[r.ID] = r
+	}
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history log: %w", err)
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			if i == len(lines)-1 {
+				// a torn last line from an interrupted write
+				break
+			}
+			return nil, fmt.Errorf("history log line %d: %w", i+1, err)
+		}
+		switch {
+		case rec.Run != nil:
+			runs = append(runs, rec.Run)
+			byID[rec.Run.ID] = rec.Run
+		case rec.Undo != nil:
+			if r, ok := byID[rec.Undo.ID]; ok {
+				r.UndoneAt = rec.Undo.Time
+			}
+		}
+	}
+	return runs, nil
+}
+
+// Find returns the run with the given ID, which may be shortened to a
+// unique prefix, or the latest run not undone yet when id is empty.
+func Find(runs []*Run, id string) (*Run, error) {
+	if id == "" {
+		for i := len(runs) - 1; i >= 0; i-- {
+			if runs[i].UndoneAt.IsZero() {
+				return runs[i], nil
+			}
+		}
+		return nil, errors.New("no run left to undo")
+	}
+
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	var found *Run
+	for _, r := range runs {
+		if strings.HasPrefix(r.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("run ID %q is ambiguous", id)
+			}
+			found = r
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no run with ID %q", id)
+	}
+	return found, nil
+}
+
+// Later returns the runs after run that were not undone and touched any
+// of its paths, along with the shared paths.
+func Later(runs []*Run, run *Run) ([]*Run, []string) {
+	mine := make(map[string]struct{})
+	for _, p := range run.Touched() {
+		mine[p] = struct{}{}
+	}
+
+	var later []*Run
+	var shared []string
+	after := false
+	for _, r := range runs {
+		if r == run {
+			after = true
+			continue
+		}
+		if !after || !r.UndoneAt.IsZero() {
+			continue
+		}
+		overlap := false
+		for _, p := range r.Touched() {
+			if _, ok := mine[p]; ok {
+				overlap = true
+				shared = append(shared, p)
+			}
+		}
+		if overlap {
+			later = append(later, r)
+		}
+	}
+	return later, shared
+}
@@ -0,0 +1,88 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_AppendLoadFind(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	first := &Run{ID: NewRunID(t0), Time: t0, Command: "organize"}
+	second := &Run{ID: NewRunID(t0.Add(time.Hour)), Time: t0.Add(time.Hour), Command: "dupes"}
+	for _, r := range []*Run{first, second} {
+		if err := Append(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MarkUndone(dir, second.ID, t0.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != first.ID || runs[1].ID != second.ID {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	if !runs[0].UndoneAt.IsZero() || runs[1].UndoneAt.IsZero() {
+		t.Error("undo not recorded on the right run")
+	}
+
+	// the latest run not undone yet
+	if r, err := Find(runs, ""); err != nil || r.ID != first.ID {
+		t.Errorf("Find(\"\") = %v, %v", r, err)
+	}
+	if r, err := Find(runs, second.ID[:11]); err != nil || r.ID != second.ID {
+		t.Errorf("Find(prefix) = %v, %v", r, err)
+	}
+	if _, err := Find(runs, "20260301"); err == nil {
+		t.Error("expected an ambiguous prefix to fail")
+	}
+	if _, err := Find(runs, "19990101"); err == nil {
+		t.Error("expected an unknown ID to fail")
+	}
+}
+
+func TestLoad_TornLastLineAndLegacy(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, FileName), []byte(`{"moved_files":{"/a/x":"/a/y"}}`), 0644)
+	if err := Append(dir, &Run{ID: "20260301-100000-abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(filepath.Join(dir, StoreName), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"run":{"id":"2026`)
+	f.Close()
+
+	runs, err := Load(dir)
+	if err != nil {
+		t.Fatalf("a torn last line should be skipped: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected the legacy run and one logged run, got %d", len(runs))
+	}
+	if !runs[0].Legacy || runs[0].ID != LegacyRunID || runs[0].Counts.Moved != 1 {
+		t.Errorf("legacy run not read: %+v", runs[0])
+	}
+}
+
+func TestLater(t *testing.T) {
+	a := &Run{ID: "a", State: HistoryState{MovedFiles: map[string]string{"/r/docs/x": "/r/x"}}}
+	b := &Run{ID: "b", State: HistoryState{MovedFiles: map[string]string{"/r/old/x": "/r/docs/x"}}}
+	c := &Run{ID: "c", State: HistoryState{MovedFiles: map[string]string{"/r/img/y": "/r/y"}}}
+	runs := []*Run{a, b, c}
+
+	later, shared := Later(runs, a)
+	if len(later) != 1 || later[0] != b || len(shared) != 1 || shared[0] != "/r/docs/x" {
+		t.Errorf("Later(a) = %v, %v", later, shared)
+	}
+
+	b.UndoneAt = time.Now()
+	if later, _ := Later(runs, a); len(later) != 0 {
+		t.Errorf("undone runs should not conflict, got %v", later)
+	}
+}
@@ -0,0 +1,235 @@
+// Package ignore matches paths against gitignore-style pattern lists such
+// as those in .fileaterignore files.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileName is the name of the ignore files read from the root and, in
+// recursive mode, from every subdirectory.
+const FileName = ".fileaterignore"
+
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// List is the patterns of one ignore file, relative to the directory that
+// holds it.
+type List struct {
+	base     string
+	patterns []pattern
+}
+
+// Compile parses gitignore-style lines relative to the directory base:
+//
+//   - blank lines and lines starting with # are ignored
+//   - a leading ! re-includes what earlier patterns excluded
+//   - a trailing / matches directories only
+//   - a pattern with a / anywhere else is anchored to base; otherwise it
+//     matches the name at any depth
+//   - * and ? match within one path element, [a-z] matches a class, and **
+//     matches any number of directories in "**/x", "x/**" and "x/**/y"
+//   - a backslash escapes the next character, e.g. \# or \!
+func Compile(base string, lines []string) (*List, error) {
+	l := &List{base: filepath.Clean(base)}
+	for i, line := range lines {
+		p, ok, err := compileLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if ok {
+			l.patterns = append(l.patterns, p)
+		}
+	}
+	return l, nil
+}
+
+// Load reads the ignore file at path; its patterns are relative to the
+// file's directory.
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	l, err := Compile(filepath.Dir(path), lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+func compileLine(line string) (pattern, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false, nil
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, `\/`) {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false, nil
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	if err := translate(&re, line); err != nil {
+		return pattern{}, false, err
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return pattern{}, false, fmt.Errorf("bad pattern %q: %w", line, err)
+	}
+	p.re = compiled
+	return p, true, nil
+}
+
+// trimTrailingSpaces drops trailing spaces unless they are escaped.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// translate writes the regular expression for a glob.
+func translate(re *strings.Builder, glob string) error {
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				atStart := i == 0 || glob[i-1] == '/'
+				rest := glob[i+2:]
+				switch {
+				case atStart && strings.HasPrefix(rest, "/"):
+					// "**/" matches zero or more directories
+					re.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				case atStart && rest == "":
+					// trailing "/**" matches everything inside
+					re.WriteString(".*")
+					i++
+					continue
+				}
+				// any other "**" is a plain "*"
+				for i+1 < len(glob) && glob[i+1] == '*' {
+					i++
+				}
+			}
+			re.WriteString("[^/]*")
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			// a leading ! negates the class, and a ] right after the
+			// opening bracket is part of it
+			j := i + 1
+			if j < len(glob) && glob[j] == '!' {
+				j++
+			}
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(glob[j:], ']')
+			if end < 0 {
+				return fmt.Errorf("unterminated character class in %q", glob)
+			}
+			class := glob[i+1 : j+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i = j + end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				c = glob[i]
+			}
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return nil
+}
+
+// Match reports whether the list decides about path, and if so whether
+// path is ignored. The last matching pattern wins, so a list that matches
+// nothing leaves the decision to others.
+func (l *List) Match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(l.base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			matched, ignored = true, !p.negate
+		}
+	}
+	return matched, ignored
+}
+
+// Matcher combines lists, later ones taking precedence over earlier ones.
+// Add lists shallow to deep, as gitignore lets deeper files override their
+// parents, and command-line patterns last.
+type Matcher struct {
+	lists []*List
+}
+
+// Add appends a list with the highest precedence so far.
+func (m *Matcher) Add(l *List) {
+	m.lists = append(m.lists, l)
+}
+
+// Ignored reports whether path should be skipped. Directories must be
+// checked as they are reached: like git, a file inside an ignored
+// directory cannot be re-included.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, l := range m.lists {
+		if ok, ign := l.Match(path, isDir); ok {
+			ignored = ign
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,92 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestList_Match(t *testing.T) {
+	base := filepath.FromSlash("/data")
+	tests := []struct {
+		name    string
+		lines   []string
+		path    string
+		isDir   bool
+		matched bool
+		ignored bool
+	}{
+		{"Name Any Depth", []string{"*.log"}, "a/b/debug.log", false, true, true},
+		{"No Match", []string{"*.log"}, "a/notes.txt", false, false, false},
+		{"Anchored Leading Slash", []string{"/todo.txt"}, "sub/todo.txt", false, false, false},
+		{"Anchored Root", []string{"/todo.txt"}, "todo.txt", false, true, true},
+		{"Anchored Middle Slash", []string{"doc/*.pdf"}, "doc/a.pdf", false, true, true},
+		{"Star Stays In Element", []string{"doc/*.pdf"}, "doc/x/a.pdf", false, false, false},
+		{"Leading Double Star", []string{"**/build"}, "x/y/build", true, true, true},
+		{"Trailing Double Star", []string{"cache/**"}, "cache/a/b.bin", false, true, true},
+		{"Trailing Double Star Not Dir Itself", []string{"cache/**"}, "cache", true, false, false},
+		{"Middle Double Star", []string{"a/**/z.txt"}, "a/z.txt", false, true, true},
+		{"Middle Double Star Deep", []string{"a/**/z.txt"}, "a/b/c/z.txt", false, true, true},
+		{"Dir Only On File", []string{"tmp/"}, "tmp", false, false, false},
+		{"Dir Only On Dir", []string{"tmp/"}, "x/tmp", true, true, true},
+		{"Negation", []string{"*.log", "!keep.log"}, "keep.log", false, true, false},
+		{"Last Match Wins", []string{"!keep.log", "*.log"}, "keep.log", false, true, true},
+		{"Question Mark", []string{"file?.txt"}, "file1.txt", false, true, true},
+		{"Class", []string{"file[0-9].txt"}, "file7.txt", false, true, true},
+		{"Negated Class", []string{"file[!0-9].txt"}, "file7.txt", false, false, false},
+		{"Comment And Blank", []string{"# *.txt", ""}, "a.txt", false, false, false},
+		{"Escaped Hash", []string{`\#notes`}, "#notes", false, true, true},
+		{"Escaped Bang", []string{`\!important`}, "!important", false, true, true},
+		{"Trailing Spaces", []string{"a.txt   "}, "a.txt", false, true, true},
+		{"Outside Base", []string{"*"}, "../other/a.txt", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := Compile(base, tt.lines)
+			if err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+			matched, ignored := l.Match(filepath.Join(base, filepath.FromSlash(tt.path)), tt.isDir)
+			if matched != tt.matched || ignored != tt.ignored {
+				t.Errorf("Match(%q) = %v, %v; want %v, %v", tt.path, matched, ignored, tt.matched, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	if _, err := Compile(".", []string{"ok", "bad[.txt"}); err == nil {
+		t.Error("expected an error for an unterminated class")
+	}
+}
+
+func TestMatcher_DeeperFilesOverride(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(root, FileName), []byte("*.tmp\n"), 0644)
+	os.WriteFile(filepath.Join(sub, FileName), []byte("!keep.tmp\n"), 0644)
+
+	var m Matcher
+	for _, dir := range []string{root, sub} {
+		l, err := Load(filepath.Join(dir, FileName))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		m.Add(l)
+	}
+
+	tests := map[string]bool{
+		filepath.Join(root, "a.tmp"):    true,
+		filepath.Join(sub, "b.tmp"):     true,
+		filepath.Join(sub, "keep.tmp"):  false,
+		filepath.Join(root, "keep.tmp"): true,
+		filepath.Join(root, "a.txt"):    false,
+	}
+	for path, want := range tests {
+		if got := m.Ignored(path, false); got != want {
+			t.Errorf("Ignored(%s) = %v; want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ageUnits are the suffixes ParseAge accepts beyond Go's own durations.
+var ageUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// ParseAge parses a duration such as "90s", "15m", "2h", "30d", "1w" or
+// "1y". Plain Go durations ("1h30m") are accepted as well.
+func ParseAge(ageStr string) (time.Duration, error) {
+	ageStr = strings.TrimSpace(ageStr)
+	if ageStr == "" {
+		return 0, nil
+	}
+
+	if mult, ok := ageUnits[ageStr[len(ageStr)-1]]; ok {
+		value, err := strconv.ParseInt(ageStr[:len(ageStr)-1], 10, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid age value: %s", ageStr)
+		}
+		if value > int64(1<<63-1)/int64(mult) {
+			return 0, fmt.Errorf("age too large: %s", ageStr)
+		}
+		return time.Duration(value) * mult, nil
+	}
+
+	d, err := time.ParseDuration(ageStr)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %s", ageStr)
+	}
+	return d, nil
+}
+
+// AgeLimit bounds the modification time of a file, either relative to the
+// start of the run or at a fixed point in time.
+type AgeLimit struct {
+	Age time.Duration
+	At  time.Time
+}
+
+// ParseAgeLimit parses an age as accepted by ParseAge or an absolute
+// RFC3339 time such as "2024-01-31T18:00:00+01:00". Without an offset
+// ("2024-01-31T18:00:00", "2024-01-31") the time is local.
+func ParseAgeLimit(s string) (AgeLimit, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return AgeLimit{At: t}, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return AgeLimit{At: t}, nil
+		}
+	}
+	d, err := ParseAge(s)
+	if err != nil {
+		return AgeLimit{}, fmt.Errorf("%w (want a duration like 30d or an RFC3339 time)", err)
+	}
+	return AgeLimit{Age: d}, nil
+}
+
+// IsZero reports whether no limit is set.
+func (a AgeLimit) IsZero() bool {
+	return a.Age == 0 && a.At.IsZero()
+}
+
+// Cutoff returns the point in time the limit refers to.
+func (a AgeLimit) Cutoff(now time.Time) time.Time {
+	if !a.At.IsZero() {
+		return a.At
+	}
+	return now.Add(-a.Age)
+}
+
+// Older reports whether mtime is at or before the cutoff.
+func (a AgeLimit) Older(mtime, now time.Time) bool {
+	return !mtime.After(a.Cutoff(now))
+}
+
+// Newer reports whether mtime is at or after the cutoff.
+func (a AgeLimit) Newer(mtime, now time.Time) bool {
+	return !mtime.Before(a.Cutoff(now))
+}
+
+// SetAgeFilters sets --older-than and --newer-than: only files modified
+// before the first and after the second limit are organized.
+func (o *Organizer) SetAgeFilters(olderThan, newerThan string) error {
+	older, err := ParseAgeLimit(olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid older-than: %w", err)
+	}
+	newer, err := ParseAgeLimit(newerThan)
+	if err != nil {
+		return fmt.Errorf("invalid newer-than: %w", err)
+	}
+
+	if !older.IsZero() && !newer.IsZero() {
+		now := time.Now()
+		if !older.Cutoff(now).After(newer.Cutoff(now)) {
+			return fmt.Errorf("older-than and newer-than leave no files to organize")
+		}
+	}
+
+	o.olderThan, o.newerThan = older, newer
+	return nil
+}
+
+// skipByAge reports whether the age filters exclude the file, logging
+// the skip. The cutoffs are taken at the start of the run.
+func (o *Organizer) skipByAge(path string, info fs.FileInfo) bool {
+	mtime := info.ModTime()
+	var reason string
+	switch {
+	case !o.olderThan.IsZero() && !o.olderThan.Older(mtime, o.startTime):
+		reason = "too new"
+	case !o.newerThan.IsZero() && !o.newerThan.Newer(mtime, o.startTime):
+		reason = "too old"
+	default:
+		return false
+	}
+
+	log.Printf("Skipped (%s): %s (modified %s)", reason, path, mtime.Format(time.RFC3339))
+	o.logger.Info("File skipped - "+reason,
+		"action", "SKIP_AGE",
+		"path", path,
+		"mtime", mtime,
+	)
+	return true
+}
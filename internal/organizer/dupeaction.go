@@ -0,0 +1,174 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/riccione/fileater/internal/filecmp"
+	"github.com/riccione/fileater/internal/history"
+	"github.com/riccione/fileater/internal/trash"
+)
+
+// DupeAction selects what happens to a file whose content is already in
+// the category folders. Every action but skip is recorded in the history
+// and reversed by undo.
+type DupeAction int
+
+const (
+	// DupeSkip leaves duplicates where they are, the default.
+	DupeSkip DupeAction = iota
+	// DupeQuarantine moves duplicates into .fileater-quarantine/<run-id>
+	// in the root.
+	DupeQuarantine
+	// DupeTrash moves duplicates to the freedesktop.org trash.
+	DupeTrash
+	// DupeHardlink replaces duplicates by a hardlink to the kept copy, so
+	// their data is stored once.
+	DupeHardlink
+)
+
+// ParseDupeAction parses the --dupe-action flag value.
+func ParseDupeAction(s string) (DupeAction, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "skip":
+		return DupeSkip, nil
+	case "quarantine":
+		return DupeQuarantine, nil
+	case "trash":
+		return DupeTrash, nil
+	case "hardlink":
+		return DupeHardlink, nil
+	}
+	return DupeSkip, fmt.Errorf("unknown duplicate action %q (want skip, quarantine, trash or hardlink)", s)
+}
+
+func (a DupeAction) String() string {
+	switch a {
+	case DupeQuarantine:
+		return "quarantine"
+	case DupeTrash:
+		return "trash"
+	case DupeHardlink:
+		return "hardlink"
+	}
+	return "skip"
+}
+
+// verb is the past tense used in progress messages.
+func (a DupeAction) verb() string {
+	switch a {
+	case DupeQuarantine:
+		return "Quarantined"
+	case DupeTrash:
+		return "Trashed"
+	case DupeHardlink:
+		return "Hardlinked"
+	}
+	return "Skipped"
+}
+
+// SetDupeAction selects what happens to duplicates in this run.
+func (o *Organizer) SetDupeAction(action DupeAction) {
+	o.dupeAction = action
+}
+
+// handleDuplicate applies the duplicate action to path, whose content is
+// the same as twin's, and records it for undo.
+func (o *Organizer) handleDuplicate(path, twin string) error {
+	// Modes that keep or link the original never touch it
+	if o.dupeAction == DupeSkip || o.mode != ModeMove {
+		return nil
+	}
+	if o.dryRun {
+		log.Printf("[DRYRUN] Would %s duplicate %s", o.dupeAction, path)
+		return nil
+	}
+
+	rec := history.Duplicate{Action: o.dupeAction.String(), Path: path, KeptCopy: twin}
+	// what is known before acting goes into the journal
+	var err error
+	switch o.dupeAction {
+	case DupeQuarantine:
+		rec.Stored, err = o.quarantinePath(path)
+	case DupeHardlink:
+		if same, _ := filecmp.SameFile(path, twin); same {
+			// linked by an earlier run already
+			return nil
+		}
+		var info fs.FileInfo
+		if info, err = os.Lstat(path); err == nil {
+			rec.Mode, rec.ModTime = info.Mode(), info.ModTime()
+		}
+	}
+	var seq int
+	if err == nil {
+		seq, err = o.intend(history.Op{Kind: history.OpDuplicate, Dup: &rec})
+	}
+	if err == nil {
+		switch o.dupeAction {
+		case DupeQuarantine:
+			_, err = o.moveFile(path, rec.Stored)
+		case DupeTrash:
+			var item trash.Item
+			item, err = trash.Put(path, time.Now())
+			rec.Stored, rec.TrashInfo = item.File, item.Info
+		case DupeHardlink:
+			err = replaceWithLink(path, twin)
+		}
+		if err != nil {
+			o.fail(seq, err)
+		}
+	}
+	if err != nil {
+		o.logger.Error("Failed to set duplicate aside",
+			"action", strings.ToUpper(o.dupeAction.String()),
+			"source", path,
+			"error", err.Error(),
+		)
+		return fmt.Errorf("failed to %s duplicate: %w", o.dupeAction, err)
+	}
+	o.done(seq, &rec)
+	o.duplicates = append(o.duplicates, rec)
+
+	log.Printf("%s duplicate: %s", o.dupeAction.verb(), path)
+	o.logger.Info("Duplicate set aside",
+		"action", strings.ToUpper(o.dupeAction.String()),
+		"source", path,
+		"duplicate_of", twin,
+		"stored", rec.Stored,
+	)
+	return nil
+}
+
+// quarantinePath returns where a duplicate goes below the run's quarantine
+// folder, keeping its path relative to the source it was found in, and
+// creates its directory.
+func (o *Organizer) quarantinePath(path string) (string, error) {
+	rel, err := filepath.Rel(o.sourceRoot(path), path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	dest := filepath.Join(o.rootPath, history.QuarantineDir, o.runID, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	return o.resolveCollision(dest), nil
+}
+
+// replaceWithLink swaps path for a hardlink to twin.
+func replaceWithLink(path, twin string) error {
+	tmp := filepath.Join(filepath.Dir(path), history.LinkTempPrefix+filepath.Base(path))
+	if err := os.Link(twin, tmp); err != nil {
+		return fmt.Errorf("hardlink failed (duplicate and kept copy must share a filesystem): %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/riccione/fileater/internal/config"
+	"github.com/riccione/fileater/internal/filecmp"
+	"github.com/riccione/fileater/internal/hashcache"
+	"github.com/riccione/fileater/internal/history"
+	"github.com/riccione/fileater/internal/ignore"
+)
+
+// DupeGroup is a set of files with the same content or, for a similar
+// group, of images that look alike.
+type DupeGroup struct {
+	// Size of each file; of the largest one in a similar group.
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Files lists the paths in the order they were found.
+	Files []string `json:"files"`
+	// Similar marks images whose perceptual hashes are close; Sizes then
+	// holds the size of each file and Distance the largest Hamming
+	// distance between two of them.
+	Similar  bool    `json:"similar,omitempty"`
+	Sizes    []int64 `json:"sizes,omitempty"`
+	Distance int     `json:"distance,omitempty"`
+	// Keep is the file the keep policy keeps; empty when it chose none.
+	Keep string `json:"keep,omitempty"`
+}
+
+// Reclaimable returns the space freed by keeping a single copy: the kept
+// file, or the largest of a similar group without one.
+func (g DupeGroup) Reclaimable() int64 {
+	if !g.Similar {
+		return g.Size * int64(len(g.Files)-1)
+	}
+	var total, kept int64
+	for i, size := range g.Sizes {
+		total += size
+		if g.Files[i] == g.Keep || (g.Keep == "" && size > kept) {
+			kept = size
+		}
+	}
+	return total - kept
+}
+
+// FileSize returns the size of one of the group's files.
+func (g DupeGroup) FileSize(path string) int64 {
+	for i, f := range g.Files {
+		if f == path && i < len(g.Sizes) {
+			return g.Sizes[i]
+		}
+	}
+	return g.Size
+}
+
+// KeepPolicy decides which file of a duplicate group is kept.
+type KeepPolicy struct {
+	kind string
+	// category whose folder holds the file to keep, for "category:NAME"
+	category string
+}
+
+// ParseKeepPolicy parses the --keep flag value: oldest, newest, largest,
+// shortest (path) or category:NAME.
+func ParseKeepPolicy(s string) (KeepPolicy, error) {
+	s = strings.TrimSpace(s)
+	if name, ok := strings.CutPrefix(s, "category:"); ok {
+		if name == "" {
+			return KeepPolicy{}, fmt.Errorf("keep policy %q names no category", s)
+		}
+		return KeepPolicy{kind: "category", category: name}, nil
+	}
+	switch strings.ToLower(s) {
+	case "", "oldest":
+		return KeepPolicy{kind: "oldest"}, nil
+	case "newest", "largest", "shortest":
+		return KeepPolicy{kind: strings.ToLower(s)}, nil
+	}
+	return KeepPolicy{}, fmt.Errorf("unknown keep policy %q (want oldest, newest, largest, shortest or category:NAME)", s)
+}
+
+// Category returns the category named by a category:NAME policy.
+func (p KeepPolicy) Category() string {
+	return p.category
+}
+
+func (p KeepPolicy) String() string {
+	if p.kind == "category" {
+		return "category:" + p.category
+	}
+	return p.kind
+}
+
+// FindDupes scans the given trees and groups the files with identical
+// content, largest reclaimable space first. The trees become the
+// organizer's sources, so the duplicates can then be set aside with
+// ResolveDupes. Empty files and the files fileater keeps in the root are
+// left out.
+func (o *Organizer) FindDupes(ctx context.Context, paths ...string) ([]DupeGroup, error) {
+	o.startTime = time.Now()
+	o.runID = history.NewRunID(o.startTime)
+	o.command = "dupes"
+	absPath, err := filepath.Abs(o.rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	o.rootPath = absPath
+	o.SetSources(paths...)
+	if err := o.resolveSources(); err != nil {
+		return nil, err
+	}
+
+	index := o.newDupIndex()
+	groups := make(map[string]*DupeGroup)
+	var order []string
+
+	err = o.walkDupeCandidates(ctx, func(path string, info fs.FileInfo) {
+		twin, sums, err := index.find(path, info.Size())
+		if err != nil {
+			log.Printf("Error hashing %s: %v", path, err)
+			return
+		}
+		if twin == "" {
+			index.add(path, info.Size(), sums)
+			return
+		}
+		g, ok := groups[twin]
+		if !ok {
+			g = &DupeGroup{Size: info.Size(), SHA256: sums.full, Files: []string{twin}}
+		}
+		// extra names of one file take no space of their own
+		for _, f := range g.Files {
+			if same, _ := filecmp.SameFile(path, f); same {
+				return
+			}
+		}
+		if !ok {
+			groups[twin] = g
+			order = append(order, twin)
+		}
+		g.Files = append(g.Files, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DupeGroup, 0, len(order))
+	for _, first := range order {
+		result = append(result, *groups[first])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Reclaimable() > result[j].Reclaimable()
+	})
+	return result, nil
+}
+
+// walkDupeCandidates calls fn for every non-empty regular file in the
+// sources within the size limits, once each, leaving out quarantined
+// files and the files fileater keeps in a root.
+func (o *Organizer) walkDupeCandidates(ctx context.Context, fn func(string, fs.FileInfo)) error {
+	seen := make(map[string]struct{})
+	for _, source := range o.sources {
+		err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			if err != nil {
+				log.Printf("Error accessing path %s: %v", path, err)
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == history.QuarantineDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || isStateFile(d.Name()) {
+				return nil
+			}
+			// nested sources are walked once
+			if _, dup := seen[path]; dup {
+				return nil
+			}
+			seen[path] = struct{}{}
+
+			info, err := d.Info()
+			if err != nil || info.Size() == 0 {
+				return nil
+			}
+			if (o.minSize > 0 && info.Size() < o.minSize) || (o.maxSize > 0 && info.Size() > o.maxSize) {
+				return nil
+			}
+			fn(path, info)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyKeepPolicy sets the file to keep in each group. With a category
+// policy, groups without a file in that category's folder keep none.
+func (o *Organizer) ApplyKeepPolicy(groups []DupeGroup, policy KeepPolicy) {
+	for i := range groups {
+		groups[i].Keep = o.chooseKeep(groups[i].Files, policy)
+	}
+}
+
+func (o *Organizer) chooseKeep(files []string, policy KeepPolicy) string {
+	candidates := files
+	if policy.kind == "category" {
+		dir := o.categoryDir(policy.category)
+		candidates = nil
+		for _, f := range files {
+			if isWithin(dir, f) {
+				candidates = append(candidates, f)
+			}
+		}
+		if len(candidates) == 0 {
+			return ""
+		}
+	}
+
+	stat := func(path string) fs.FileInfo {
+		if info, err := os.Stat(path); err == nil {
+			return info
+		}
+		return nil
+	}
+	modTime := func(path string) time.Time {
+		if info := stat(path); info != nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+	size := func(path string) int64 {
+		if info := stat(path); info != nil {
+			return info.Size()
+		}
+		return 0
+	}
+	best := candidates[0]
+	for _, f := range candidates[1:] {
+		var better bool
+		switch policy.kind {
+		case "newest":
+			better = modTime(f).After(modTime(best))
+		case "largest":
+			better = size(f) > size(best)
+		case "shortest":
+			better = len(f) < len(best) || (len(f) == len(best) && f < best)
+		default:
+			// oldest, and the tie-break within a category
+			better = modTime(f).Before(modTime(best))
+		}
+		if better {
+			best = f
+		}
+	}
+	return best
+}
+
+// ResolveDupes applies the duplicate action to every file of the groups
+// except the one kept, then saves the history so undo can reverse it.
+// Groups without a file to keep are left alone.
+func (o *Organizer) ResolveDupes(groups []DupeGroup) error {
+	if o.dupeAction == DupeSkip {
+		return fmt.Errorf("no duplicate action chosen")
+	}
+	if err := o.beginJournal(); err != nil {
+		return err
+	}
+	recorded := false
+	defer func() { o.endJournal(!recorded) }()
+
+	var errCount int
+	for _, g := range groups {
+		if g.Keep == "" {
+			continue
+		}
+		if g.Similar && o.dupeAction == DupeHardlink {
+			// a link would replace the image by a different one
+			log.Printf("Skipped similar images of %s: they cannot be hardlinked", g.Keep)
+			continue
+		}
+		for _, f := range g.Files {
+			if f == g.Keep {
+				continue
+			}
+			if err := o.handleDuplicate(f, g.Keep); err != nil {
+				log.Printf("Error: %v", err)
+				errCount++
+			}
+		}
+	}
+
+	if !o.dryRun && len(o.duplicates) > 0 {
+		if err := o.SaveHistory(); err != nil {
+			return err
+		}
+	}
+	recorded = true
+	if errCount > 0 {
+		return fmt.Errorf("%d duplicate(s) could not be set aside", errCount)
+	}
+	return nil
+}
+
+// isStateFile reports whether name is one of the files fileater keeps in
+// a root.
+func isStateFile(name string) bool {
+	return name == history.FileName || name == history.StoreName || name == history.JournalName || name == hashcache.FileName || name == ignore.FileName || config.IsRootConfig(name)
+}
@@ -0,0 +1,219 @@
+package organizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/riccione/fileater/internal/filecmp"
+)
+
+const (
+	// hashKindSHA256 names the full-content checksums in the hash cache.
+	hashKindSHA256 = "sha256"
+	// hashKindEnds names the checksums of a file's first and last blocks.
+	hashKindEnds = "sha256-ends"
+)
+
+// endBlock is the size of the blocks at each end of a file hashed before
+// its whole content; files up to two blocks long skip that stage.
+const endBlock = 16 * 1024
+
+// wholeFile is the partial hash shared by files too small to have one.
+const wholeFile = "-"
+
+// dupSums are the hashes of a file computed by the duplicate index so
+// far; empty ones were not needed yet.
+type dupSums struct {
+	ends string
+	full string
+}
+
+// dupGroup holds the files of one size whose first and last blocks match.
+type dupGroup struct {
+	// files whose full hash is not known yet
+	pending []string
+	// full hash => first file with that content
+	hashed map[string]string
+}
+
+// dupIndex tracks the content of every file in the category folders and
+// every file organized so far, so a duplicate is found wherever its twin
+// lives. Comparison is staged to read as little as possible: files are
+// keyed by size, hashed at both ends only once another file of the same
+// size shows up, and hashed in full only when the ends match too.
+type dupIndex struct {
+	// size => files not hashed yet
+	pending map[int64][]string
+	// size => hash of the ends => files with those ends
+	groups map[int64]map[string]*dupGroup
+	ends   func(string, int64) (string, error)
+	full   func(string) (string, error)
+	// same confirms a match byte for byte when set
+	same func(string, string) (bool, error)
+}
+
+func newDupIndex(ends func(string, int64) (string, error), full func(string) (string, error)) *dupIndex {
+	return &dupIndex{
+		pending: make(map[int64][]string),
+		groups:  make(map[int64]map[string]*dupGroup),
+		ends:    ends,
+		full:    full,
+	}
+}
+
+// add indexes a file with the hashes known so far.
+func (x *dupIndex) add(path string, size int64, sums dupSums) {
+	if sums.ends == "" {
+		x.pending[size] = append(x.pending[size], path)
+		return
+	}
+	if x.groups[size] == nil {
+		x.groups[size] = make(map[string]*dupGroup)
+	}
+	g := x.groups[size][sums.ends]
+	if g == nil {
+		g = &dupGroup{hashed: make(map[string]string)}
+		x.groups[size][sums.ends] = g
+	}
+	if sums.full == "" {
+		g.pending = append(g.pending, path)
+		return
+	}
+	if _, ok := g.hashed[sums.full]; !ok {
+		g.hashed[sums.full] = path
+	}
+}
+
+// find returns an indexed file with the same content as path, along with
+// the hashes of path computed on the way.
+func (x *dupIndex) find(path string, size int64) (string, dupSums, error) {
+	var sums dupSums
+	if len(x.pending[size]) == 0 && len(x.groups[size]) == 0 {
+		return "", sums, nil
+	}
+
+	for _, p := range x.pending[size] {
+		h, err := x.ends(p, size)
+		if err != nil {
+			continue
+		}
+		x.add(p, size, dupSums{ends: h})
+	}
+	delete(x.pending, size)
+
+	var err error
+	if sums.ends, err = x.ends(path, size); err != nil {
+		return "", dupSums{}, err
+	}
+	g := x.groups[size][sums.ends]
+	if g == nil {
+		return "", sums, nil
+	}
+
+	for _, p := range g.pending {
+		h, err := x.full(p)
+		if err != nil {
+			continue
+		}
+		if _, ok := g.hashed[h]; !ok {
+			g.hashed[h] = p
+		}
+	}
+	g.pending = nil
+
+	if sums.full, err = x.full(path); err != nil {
+		return "", dupSums{}, err
+	}
+	twin, ok := g.hashed[sums.full]
+	if !ok || twin == path {
+		return "", sums, nil
+	}
+	if x.same != nil {
+		same, err := x.same(path, twin)
+		if err != nil {
+			return "", dupSums{}, err
+		}
+		if !same {
+			return "", sums, nil
+		}
+	}
+	return twin, sums, nil
+}
+
+// SetVerifyDupes makes duplicate detection compare files byte for byte
+// before treating equal hashes as a match, even when duplicates are only
+// skipped.
+func (o *Organizer) SetVerifyDupes(verify bool) {
+	o.verifyDupes = verify
+}
+
+// hashEnds returns the SHA-256 of the first and last blocks of a file of
+// the given size, or wholeFile when the file is too small to have both.
+func (o *Organizer) hashEnds(path string, size int64) (string, error) {
+	if size <= 2*endBlock {
+		return wholeFile, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return o.cachedSum(file, path, hashKindEnds, func(f *os.File) (string, error) {
+		hasher := sha256.New()
+		buf := make([]byte, endBlock)
+		for _, off := range []int64{0, size - endBlock} {
+			if _, err := f.ReadAt(buf, off); err != nil {
+				return "", err
+			}
+			hasher.Write(buf)
+		}
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	})
+}
+
+// newDupIndex returns an empty index using the organizer's hashing.
+// Matches are confirmed byte for byte when asked to, and always when
+// duplicates are set aside: a cached hash can be stale for a file
+// rewritten with the same size and modification time.
+func (o *Organizer) newDupIndex() *dupIndex {
+	x := newDupIndex(o.hashEnds, o.hashFile)
+	if o.verifyDupes || o.dupeAction != DupeSkip {
+		x.same = filecmp.SameContent
+	}
+	return x
+}
+
+// buildDupIndex indexes the files already in the category folders.
+func (o *Organizer) buildDupIndex() {
+	o.dupes = o.newDupIndex()
+	for dir := range o.targetPaths {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				// nested category folders are walked on their own
+				if _, isTarget := o.targetPaths[path]; isTarget && path != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			o.dupes.add(path, info.Size(), dupSums{})
+			return nil
+		})
+	}
+}
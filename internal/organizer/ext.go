@@ -0,0 +1,90 @@
+package organizer
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// builtinMultiExts are multi-part extensions recognized even when no
+// category lists them, so renaming never splits them apart.
+var builtinMultiExts = map[string]struct{}{
+	".tar.gz":   {},
+	".tar.bz2":  {},
+	".tar.xz":   {},
+	".tar.zst":  {},
+	".tar.lz":   {},
+	".tar.lz4":  {},
+	".tar.lzma": {},
+	".user.js":  {},
+	".user.css": {},
+	".min.js":   {},
+	".min.css":  {},
+	".d.ts":     {},
+}
+
+// splitArchiveRe matches numbered volumes such as ".part1.rar" or ".7z.001".
+var splitArchiveRe = regexp.MustCompile(`^\.part[0-9]+\.rar$|^\.7z\.[0-9]{3}$`)
+
+// isKnownExt reports whether a lowercase multi-part extension is either
+// built in or listed by the loaded config.
+func (o *Organizer) isKnownExt(ext string) bool {
+	if _, ok := builtinMultiExts[ext]; ok {
+		return true
+	}
+	if splitArchiveRe.MatchString(ext) {
+		return true
+	}
+	for _, exts := range o.categories {
+		if _, ok := exts[ext]; ok {
+			return true
+		}
+	}
+	for _, r := range o.rules {
+		if _, ok := r.exts[ext]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitExt splits a file name into its stem and its extension, preferring
+// the longest known multi-part extension over filepath.Ext.
+// Example: backup.tar.gz -> ("backup", ".tar.gz")
+func (o *Organizer) splitExt(name string) (string, string) {
+	// The first dot that starts a known suffix gives the longest match.
+	// Index 0 is skipped so dotfiles keep their whole name as the stem.
+	for i := 1; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		suffix := name[i:]
+		if strings.Count(suffix, ".") < 2 {
+			break
+		}
+		if o.isKnownExt(strings.ToLower(suffix)) {
+			return name[:i], suffix
+		}
+	}
+
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// fileExt returns the lowercase extension of path as seen by splitExt.
+func (o *Organizer) fileExt(path string) string {
+	_, ext := o.splitExt(filepath.Base(path))
+	return strings.ToLower(ext)
+}
+
+// extCandidates returns the extensions to try for a lookup, longest first.
+// A compound extension falls back to its last part, so ".gz" still
+// matches "backup.tar.gz" when only ".gz" is configured.
+func (o *Organizer) extCandidates(path string) []string {
+	ext := o.fileExt(path)
+	last := strings.ToLower(filepath.Ext(path))
+	if ext == last {
+		return []string{ext}
+	}
+	return []string{ext, last}
+}
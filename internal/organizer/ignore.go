@@ -0,0 +1,83 @@
+package organizer
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"path/filepath"
+
+	"github.com/riccione/fileater/internal/ignore"
+)
+
+// SetFilters sets the --exclude and --include patterns. Both use
+// .fileaterignore syntax relative to each source and override the ignore
+// files; an include re-includes what an exclude or ignore file skipped.
+func (o *Organizer) SetFilters(exclude, include []string) error {
+	lines := append([]string{}, exclude...)
+	for _, p := range include {
+		lines = append(lines, "!"+p)
+	}
+	if _, err := ignore.Compile(".", lines); err != nil {
+		return err
+	}
+	o.filterLines = lines
+	return nil
+}
+
+// loadIgnores sets up the matcher with the .fileaterignore of every source
+// and the command-line patterns; those of subdirectories are added by the
+// walk.
+func (o *Organizer) loadIgnores() error {
+	o.ignores = &ignore.Matcher{}
+	o.filters = nil
+	for _, source := range o.sources {
+		if err := o.loadIgnoreFile(source); err != nil {
+			return err
+		}
+		if len(o.filterLines) > 0 {
+			l, err := ignore.Compile(source, o.filterLines)
+			if err != nil {
+				return err
+			}
+			o.filters = append(o.filters, l)
+		}
+	}
+	return nil
+}
+
+// loadIgnoreFile adds the .fileaterignore of dir, if there is one.
+func (o *Organizer) loadIgnoreFile(dir string) error {
+	l, err := ignore.Load(filepath.Join(dir, ignore.FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	o.ignores.Add(l)
+	log.Printf("Ignore file loaded: %s", filepath.Join(dir, ignore.FileName))
+	return nil
+}
+
+// isIgnored reports whether an ignore file or filter pattern skips path.
+// Command-line patterns take precedence over every ignore file.
+func (o *Organizer) isIgnored(path string, isDir bool) bool {
+	if o.ignores == nil {
+		return false
+	}
+	ignored := o.ignores.Ignored(path, isDir)
+	for _, l := range o.filters {
+		if ok, ign := l.Match(path, isDir); ok {
+			ignored = ign
+		}
+	}
+	return ignored
+}
+
+func (o *Organizer) logIgnored(path string) {
+	log.Printf("Skipped (ignored): %s", path)
+	o.logger.Info("File skipped - ignored",
+		"action", "SKIP_IGNORED",
+		"path", path,
+	)
+}
@@ -0,0 +1,90 @@
+package organizer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/riccione/fileater/internal/history"
+)
+
+// beginJournal starts the write-ahead journal of the run in the root, so
+// every change is on disk before it is made. Dry runs keep none.
+func (o *Organizer) beginJournal() error {
+	if o.dryRun {
+		return nil
+	}
+	// a --dest root may not exist yet
+	if err := os.MkdirAll(o.rootPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", o.rootPath, err)
+	}
+	j, err := history.BeginJournal(o.rootPath, &history.Run{
+		ID:           o.runID,
+		Time:         o.startTime,
+		Version:      o.version,
+		Command:      o.command,
+		Flags:        o.flags,
+		ConfigDigest: o.configDigest,
+		State: history.HistoryState{
+			RunID:       o.runID,
+			RootPath:    o.rootPath,
+			SourceRoots: o.sources,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	o.journal = j
+	return nil
+}
+
+// endJournal removes the journal once the run is over. With keep, as when
+// the run failed before its history was saved, it is left for "fileater
+// recover", unless nothing was journaled.
+func (o *Organizer) endJournal(keep bool) {
+	if o.journal == nil {
+		return
+	}
+	j := o.journal
+	o.journal = nil
+	if keep && j.Changed() {
+		j.Close()
+		log.Printf("Journal kept in %s; run \"fileater recover\" to record the run", filepath.Join(o.rootPath, history.JournalName))
+		return
+	}
+	if err := j.Commit(); err != nil {
+		log.Printf("Warning: failed to remove journal: %v", err)
+	}
+}
+
+// intend journals an operation before it is made. It returns the sequence
+// number to pass to done, or 0 when there is no journal.
+func (o *Organizer) intend(op history.Op) (int, error) {
+	if o.journal == nil {
+		return 0, nil
+	}
+	return o.journal.Intend(op)
+}
+
+// fail records that a journaled operation failed, so recovery does not
+// take it for one cut short. A failure to record it is only logged.
+func (o *Organizer) fail(seq int, opErr error) {
+	if o.journal == nil || seq == 0 {
+		return
+	}
+	if err := o.journal.Fail(seq, opErr); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// done marks a journaled operation complete. A failure is only logged:
+// recovery checks unmarked operations on disk.
+func (o *Organizer) done(seq int, dup *history.Duplicate) {
+	if o.journal == nil || seq == 0 {
+		return
+	}
+	if err := o.journal.Done(seq, dup); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package organizer
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/riccione/fileater/internal/release"
+)
+
+// layoutMedia lays videos out the way Plex and Jellyfin expect:
+//
+//	video/TV/Show Name/Season 02/Show Name - S02E05.mkv
+//	video/Movies/Title (2019)/Title (2019).mkv
+const layoutMedia = "media"
+
+// mediaPlan returns the directory and file stem for a video whose name
+// parses as a TV episode or a movie.
+func (o *Organizer) mediaPlan(fc *fileContext) (string, string, bool) {
+	base := o.categoryDir(fc.category)
+
+	r := release.Parse(fc.stem)
+	switch r.Kind {
+	case release.Episode:
+		show := sanitizeElem(r.Title)
+		if r.Year > 0 {
+			show = fmt.Sprintf("%s (%d)", show, r.Year)
+		}
+		dir := filepath.Join(base, "TV", show, fmt.Sprintf("Season %02d", r.Season))
+		return dir, fmt.Sprintf("%s - S%02dE%02d", show, r.Season, r.Episode), true
+	case release.Movie:
+		title := fmt.Sprintf("%s (%d)", sanitizeElem(r.Title), r.Year)
+		return filepath.Join(base, "Movies", title), title, true
+	}
+	return "", "", false
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,11 +11,14 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/riccione/fileater/internal/config"
+	"github.com/riccione/fileater/internal/hashcache"
 	"github.com/riccione/fileater/internal/history"
+	"github.com/riccione/fileater/internal/ignore"
 )
 
 type Organizer struct {
@@ -27,17 +29,75 @@ type Organizer struct {
 	targetPaths map[string]struct{}
 	// map of Category name => set of ext
 	categories map[string]map[string]struct{}
+	// precedence of categories when an extension is listed more than once
+	categoryOrder []string
+	// ordered rules evaluated before the extension categories
+	rules []rule
+	// map of Category name => destination template
+	templates map[string]*destTemplate
+	// map of Category name => rename template
+	renames map[string]*destTemplate
+	// map of Category name => built-in layout such as "media"
+	layouts map[string]string
+	// map of Category name => absolute folder used instead of one in the root
+	dests map[string]string
+	// groups of files that move with a primary file of the same name
+	sidecars []sidecarGroup
+	// map of MIME type (or "type/*") => Category name, used by sniffing
+	mimeCategories map[string]string
+	sniffMode      SniffMode
+	mode           TransferMode
 
 	startTime  time.Time
 	totalBytes int64
 
 	minSize int64
 	maxSize int64
+	// SI size units count in powers of 1024, as --binary-units asks
+	binaryUnits bool
 
-	deleteDupes bool
+	olderThan AgeLimit
+	newerThan AgeLimit
+
+	dupeAction  DupeAction
+	verifyDupes bool
 
 	movedFiles  map[string]string
 	deletedDirs []string
+	// directories created outside the root, for undo to remove
+	createdDirs []string
+	// map of destination => source directory the file was found in
+	movedFrom map[string]string
+	// map of destination => transfer mode, for files not simply moved
+	modes map[string]string
+	// directories scanned for files; the root when empty
+	sources []string
+	// files already moved along with another one, skipped by the walk
+	claimed map[string]struct{}
+	// sidecars the walk left for their primary file to move
+	deferred []string
+	// content of the category folders and the files organized so far
+	dupes *dupIndex
+	// duplicates set aside by the duplicate action, for the history
+	duplicates []history.Duplicate
+	// identifies this run in the history and the quarantine folder
+	runID string
+	// what the history records about the run besides its changes
+	command      string
+	version      string
+	flags        []string
+	configDigest string
+	counts       history.Counts
+	// write-ahead journal of the changes; nil in a dry run
+	journal *history.Journal
+	// checksums kept between runs; nil hashes every file afresh
+	hashCache *hashcache.Cache
+
+	// .fileaterignore files found so far, and the --exclude/--include
+	// patterns on top of them
+	ignores     *ignore.Matcher
+	filters     []*ignore.List
+	filterLines []string
 }
 
 // RootPath returns the resolved root path for this organizer.
@@ -50,15 +110,12 @@ type Metrics struct {
 	FilesProcessed int
 	TotalBytes     int64
 	FilesPerSecond float64
+	// BinaryUnits reports sizes in IEC units
+	BinaryUnits bool
 }
 
 func (m Metrics) String() string {
-	var dataStr string
-	if m.TotalBytes >= 1<<30 {
-		dataStr = fmt.Sprintf("%.2f GB", float64(m.TotalBytes)/(1<<30))
-	} else {
-		dataStr = fmt.Sprintf("%.2f MB", float64(m.TotalBytes)/(1<<20))
-	}
+	dataStr := FormatSize(m.TotalBytes, m.BinaryUnits)
 
 	return fmt.Sprintf(
 		"Summary\n"+
@@ -77,7 +134,7 @@ func (m Metrics) String() string {
 	)
 }
 
-func NewOrganizer(root string, dryRun bool, recursive bool, logger *slog.Logger, minSizeStr, maxSizeStr string, deleteDupes bool) (*Organizer, error) {
+func NewOrganizer(root string, dryRun bool, recursive bool, logger *slog.Logger, minSizeStr, maxSizeStr string, binaryUnits bool) (*Organizer, error) {
 	o := &Organizer{
 		rootPath:    root,
 		dryRun:      dryRun,
@@ -85,18 +142,21 @@ func NewOrganizer(root string, dryRun bool, recursive bool, logger *slog.Logger,
 		logger:      logger,
 		targetPaths: make(map[string]struct{}),
 		categories:  make(map[string]map[string]struct{}),
-		deleteDupes: deleteDupes,
 		movedFiles:  make(map[string]string),
+		movedFrom:   make(map[string]string),
+		modes:       make(map[string]string),
 		deletedDirs: []string{},
+		claimed:     make(map[string]struct{}),
+		sidecars:    compileSidecars(defaultSidecars),
+		binaryUnits: binaryUnits,
 	}
-
-	minSize, err := ParseSize(minSizeStr)
+	minSize, err := ParseSize(minSizeStr, binaryUnits)
 	if err != nil {
 		return nil, fmt.Errorf("invalid min-size: %w", err)
 	}
 	o.minSize = minSize
 
-	maxSize, err := ParseSize(maxSizeStr)
+	maxSize, err := ParseSize(maxSizeStr, binaryUnits)
 	if err != nil {
 		return nil, fmt.Errorf("invalid max-size: %w", err)
 	}
@@ -109,6 +169,14 @@ func NewOrganizer(root string, dryRun bool, recursive bool, logger *slog.Logger,
 	return o, nil
 }
 
+// SetHashCache makes hashFile reuse the checksums of files that have not
+// changed since an earlier run, and store the ones it computes.
+func (o *Organizer) SetHashCache(c *hashcache.Cache) {
+	o.hashCache = c
+}
+
+// hashFile returns the SHA-256 of a file, from the hash cache when the
+// file is unchanged since it was last hashed.
 func (o *Organizer) hashFile(path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -116,60 +184,48 @@ func (o *Organizer) hashFile(path string) (string, error) {
 	}
 	defer file.Close()
 
-	hasher := sha256.New()
-	buf := make([]byte, 32*1024) // 32KB buffer for memory efficiency
+	return o.cachedSum(file, path, hashKindSHA256, func(f *os.File) (string, error) {
+		hasher := sha256.New()
+		buf := make([]byte, 32*1024) // 32KB buffer for memory efficiency
 
-	for {
-		n, err := file.Read(buf)
-		if n > 0 {
-			if _, writeErr := hasher.Write(buf[:n]); writeErr != nil {
-				return "", writeErr
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				if _, writeErr := hasher.Write(buf[:n]); writeErr != nil {
+					return "", writeErr
+				}
 			}
-		}
-		if err != nil {
-			if err == io.EOF {
-				break
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return "", err
 			}
-			return "", err
 		}
-	}
 
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	})
 }
 
-func (o *Organizer) findDuplicate(srcSize int64, srcHash string, destDir string) (string, error) {
-	entries, err := os.ReadDir(destDir)
+// cachedSum returns the checksum of the given kind for an open file,
+// computing it with sum unless the hash cache already has it.
+func (o *Organizer) cachedSum(file *os.File, path, kind string, sum func(*os.File) (string, error)) (string, error) {
+	if o.hashCache == nil {
+		return sum(file)
+	}
+	info, err := file.Stat()
 	if err != nil {
 		return "", err
 	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		destPath := filepath.Join(destDir, entry.Name())
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		if info.Size() != srcSize {
-			continue
-		}
-
-		destHash, err := o.hashFile(destPath)
-		if err != nil {
-			continue
-		}
-
-		if srcHash == destHash {
-			return destPath, nil
-		}
+	if cached, ok := o.hashCache.Lookup(path, info, kind); ok {
+		return cached, nil
 	}
-
-	return "", nil
+	s, err := sum(file)
+	if err != nil {
+		return "", err
+	}
+	o.hashCache.Store(path, info, kind, s)
+	return s, nil
 }
 
 // UseDefaultCategories sets up the initial categories if no JSON is provided
@@ -181,25 +237,114 @@ func (o *Organizer) UseDefaultCategories() {
 	}
 }
 
-// LoadConfig reads JSON file and populates Categories
+// LoadConfig reads JSON file and populates Categories and Rules
 func (o *Organizer) LoadConfig(configPath string) error {
-	data, err := os.ReadFile(configPath)
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		return err
 	}
+	return o.useConfig(config.Merge(config.Layer{Path: configPath, Config: cfg}))
+}
 
-	// Temporary map to decode JSON
-	var rawConfig map[string][]string
-	if err := json.Unmarshal(data, &rawConfig); err != nil {
+// LoadConfigChain merges the config lookup chain for the root (see
+// config.Resolve), with explicit on top if set. When no config file
+// exists the default categories are used.
+func (o *Organizer) LoadConfigChain(explicit string) error {
+	res, err := config.Resolve(o.rootPath, explicit)
+	if err != nil {
 		return err
 	}
+	if len(res.Sources) == 0 {
+		o.UseDefaultCategories()
+		return nil
+	}
+	return o.useConfig(res)
+}
+
+func (o *Organizer) useConfig(res *config.Resolved) error {
+	for _, src := range res.Sources {
+		log.Printf("Config loaded: %s", src)
+	}
+	for _, issue := range res.Config.Validate("") {
+		log.Printf("Config %s", issue)
+	}
+	o.configDigest = res.Config.Digest()
+	return o.ApplyConfig(res.Config)
+}
 
+// ApplyConfig adds the categories, rules and MIME mappings of cfg.
+func (o *Organizer) ApplyConfig(cfg *config.Config) error {
 	// Convert to our internal map[string]map[string]struct{} for O(1) lookup
-	for cat, exts := range rawConfig {
+	for _, cat := range cfg.Order {
+		entry := cfg.Categories[cat]
 		o.categories[cat] = make(map[string]struct{})
-		for _, ext := range exts {
+		for _, ext := range entry.Ext {
 			o.categories[cat][strings.ToLower(ext)] = struct{}{}
 		}
+		o.categoryOrder = append(o.categoryOrder, cat)
+
+		if entry.Template != "" {
+			t, err := parseDestTemplate(entry.Template)
+			if err != nil {
+				return fmt.Errorf("category %q: %w", cat, err)
+			}
+			if o.templates == nil {
+				o.templates = make(map[string]*destTemplate)
+			}
+			o.templates[cat] = t
+		}
+		if entry.Rename != "" {
+			t, err := parseNameTemplate(entry.Rename)
+			if err != nil {
+				return fmt.Errorf("category %q: %w", cat, err)
+			}
+			if o.renames == nil {
+				o.renames = make(map[string]*destTemplate)
+			}
+			o.renames[cat] = t
+		}
+		switch entry.Layout {
+		case "":
+		case layoutMedia:
+			if o.layouts == nil {
+				o.layouts = make(map[string]string)
+			}
+			o.layouts[cat] = entry.Layout
+		default:
+			return fmt.Errorf("category %q: unknown layout %q", cat, entry.Layout)
+		}
+		if entry.Dest != "" {
+			if !config.IsDestPath(entry.Dest) {
+				return fmt.Errorf("category %q: dest %q must be absolute or start with ~/", cat, entry.Dest)
+			}
+			dest, err := config.ExpandDest(entry.Dest)
+			if err != nil {
+				return fmt.Errorf("category %q: %w", cat, err)
+			}
+			if o.dests == nil {
+				o.dests = make(map[string]string)
+			}
+			o.dests[cat] = dest
+		}
+	}
+
+	for i, r := range cfg.Rules {
+		compiled, err := compileRule(r, o.binaryUnits)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		o.rules = append(o.rules, compiled)
+	}
+
+	if cfg.Sidecars != nil {
+		o.sidecars = compileSidecars(cfg.Sidecars)
+	}
+
+	if len(cfg.MIME) > 0 && o.mimeCategories == nil {
+		o.mimeCategories = make(map[string]string, len(cfg.MIME))
+	}
+	for mime, cat := range cfg.MIME {
+		o.mimeCategories[strings.ToLower(mime)] = cat
 	}
 	return nil
 }
@@ -212,52 +357,69 @@ func (o *Organizer) processFile(path string, d fs.DirEntry) error {
 	}
 	srcSize := info.Size()
 
-	category := o.categorizeFile(path)
-	destDir := filepath.Join(o.rootPath, category)
+	// Sidecars move together with their primary file
+	if o.hasPrimary(path) {
+		log.Printf("Deferred: %s moves with its primary file", d.Name())
+		o.logger.Info("Sidecar deferred to its primary file",
+			"action", "SIDECAR",
+			"path", path,
+		)
+		o.deferred = append(o.deferred, path)
+		return nil
+	}
 
-	// Duplicate detection - check if destDir exists before hashing
-	if _, err := os.Stat(destDir); err == nil {
-		srcHash, err := o.hashFile(path)
-		if err == nil {
-			dupPath, err := o.findDuplicate(srcSize, srcHash, destDir)
-			if err == nil && dupPath != "" {
-				log.Printf("Duplicate found: %s matches existing file %s", d.Name(), dupPath)
-				o.logger.Info("Duplicate detected",
-					"action", "DUPLICATE",
-					"source", path,
-					"duplicate", dupPath,
-				)
+	category := o.categorizeFile(path, info)
+	fc := o.newFileContext(category, path, info)
+	destDir, destName := o.planDest(fc)
+
+	// Duplicate detection against everything organized so far; files are
+	// only read as far as needed to tell them apart
+	dupPath, srcSums, err := o.dupes.find(path, srcSize)
+	if err == nil && dupPath != "" {
+		log.Printf("Duplicate found: %s matches existing file %s", d.Name(), dupPath)
+		o.logger.Info("Duplicate detected",
+			"action", "DUPLICATE",
+			"source", path,
+			"duplicate", dupPath,
+		)
+		return o.handleDuplicate(path, dupPath)
+	}
 
-				if o.deleteDupes {
-					if err := os.Remove(path); err != nil {
-						o.logger.Error("Failed to delete duplicate source",
-							"action", "DELETE",
-							"source", path,
-							"error", err.Error(),
-						)
-						return fmt.Errorf("failed to delete duplicate: %w", err)
-					}
-					log.Printf("Deleted duplicate: %s", path)
-					o.logger.Info("Duplicate deleted",
-						"action", "DELETE",
-						"source", path,
-						"duplicate_of", dupPath,
-					)
-				}
-				return nil
-			}
+	// Resolve collisions, for the sidecars too
+	destPath := filepath.Join(destDir, destName)
+	var finalDest string
+	sidecars := o.sidecarsOf(path)
+	if len(sidecars) > 0 {
+		suffixes := make([]string, len(sidecars))
+		for i, sc := range sidecars {
+			suffixes[i] = sidecarSuffix(fc, sc)
 		}
+		finalDest = o.resolveGroupCollision(destDir, strings.TrimSuffix(destName, fc.ext), fc.ext, suffixes)
+	} else {
+		finalDest = o.resolveCollision(destPath)
+	}
+	if fc.exif != nil {
+		o.logger.Info("Photo metadata",
+			"action", "EXIF",
+			"source", path,
+			"taken", fc.exif.DateTimeOriginal,
+			"make", fc.exif.Make,
+			"model", fc.exif.Model,
+			"orientation", fc.exif.Orientation,
+		)
 	}
-
-	// Resolve collisions
-	destPath := filepath.Join(destDir, d.Name())
-	finalDest := o.resolveCollision(destPath)
 
 	// Safety check: Don't move if source is already the destination
 	if path == destPath {
 		return nil
 	}
 
+	// Only now that the file moves is its directory made, so skipped
+	// duplicates leave no empty folders behind
+	if err := o.prepareDestDir(destDir); err != nil {
+		return err
+	}
+
 	// Get file size for metrics (before move)
 	var size int64
 	if o.dryRun {
@@ -267,61 +429,121 @@ func (o *Organizer) processFile(path string, d fs.DirEntry) error {
 		}
 	} else {
 		var err error
-		size, err = o.moveFile(path, finalDest)
+		size, err = o.transfer(path, finalDest)
 		if err != nil {
 			o.logger.Error("Move failed",
-				"action", "MOVE",
+				"action", o.mode.action(),
 				"source", path,
 				"destination", finalDest,
 				"error", err.Error(),
 			)
-			return fmt.Errorf("move failed: %w", err)
+			return fmt.Errorf("%s failed: %w", o.mode, err)
 		}
-		o.movedFiles[finalDest] = path
+		o.recordMove(finalDest, path)
+	}
+	if o.dryRun {
+		o.dupes.add(path, srcSize, srcSums)
+	} else {
+		o.dupes.add(finalDest, srcSize, srcSums)
 	}
 
 	o.totalBytes += size
 
 	// Log only success outcome
 	if !o.dryRun {
-		log.Printf("Moved: %s => %s (%s)", d.Name(), filepath.Base(finalDest), category)
+		log.Printf("%s: %s => %s (%s)", o.mode.verb(), d.Name(), filepath.Base(finalDest), category)
 		o.logger.Info("File moved",
-			"action", "MOVE",
+			"action", o.mode.action(),
 			"source", path,
 			"destination", finalDest,
 		)
 	}
 
-	return nil
+	return o.moveSidecars(fc, sidecars, finalDest)
+}
+
+// SetRunInfo sets the tool version and command-line flags recorded with
+// the run in the history.
+func (o *Organizer) SetRunInfo(version string, flags []string) {
+	o.version = version
+	o.flags = flags
 }
 
+// SaveHistory appends the run to the root's history log, so it can be
+// undone by its run ID later.
 func (o *Organizer) SaveHistory() error {
 	state := history.HistoryState{
+		RunID:       o.runID,
 		MovedFiles:  o.movedFiles,
 		DeletedDirs: o.deletedDirs,
 		RootPath:    o.rootPath,
+		SourceRoots: o.sources,
+		Sources:     o.movedFrom,
+		CreatedDirs: o.createdDirs,
+		Modes:       o.modes,
+		Duplicates:  o.duplicates,
 	}
 
-	data, err := json.MarshalIndent(state, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal history state: %w", err)
+	counts := o.counts
+	counts.Moved = len(o.movedFiles)
+	counts.Duplicates = len(o.duplicates)
+	counts.DeletedDirs = len(o.deletedDirs)
+
+	run := &history.Run{
+		ID:           o.runID,
+		Time:         o.startTime,
+		Version:      o.version,
+		Command:      o.command,
+		Flags:        o.flags,
+		ConfigDigest: o.configDigest,
+		Counts:       counts,
+		State:        state,
 	}
-
-	statePath := filepath.Join(o.rootPath, ".fileater-history.json")
-	if err := os.WriteFile(statePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write history file: %w", err)
+	if err := history.Append(o.rootPath, run); err != nil {
+		return err
 	}
 
-	log.Printf("History saved to: %s", statePath)
+	log.Printf("History saved to: %s (run %s)", filepath.Join(o.rootPath, history.StoreName), o.runID)
 	return nil
 }
 
-// categorizeFile determines the folder category based on extension
-func (o *Organizer) categorizeFile(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
+// changedAnything reports whether the run made a change undo can reverse.
+func (o *Organizer) changedAnything() bool {
+	return len(o.movedFiles) > 0 || len(o.duplicates) > 0 || len(o.deletedDirs) > 0 || len(o.createdDirs) > 0
+}
+
+// categorizeFile determines the folder category. Rules are tried in order
+// and the first match wins; otherwise the extension and, if sniffing is
+// enabled, the file content decide in the order set by the sniff mode.
+func (o *Organizer) categorizeFile(path string, info fs.FileInfo) string {
+	now := o.startTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	exts := o.extCandidates(path)
+	for _, r := range o.rules {
+		if r.matches(path, o.sourceRoot(path), exts, info, now) {
+			return r.category
+		}
+	}
 
-	for category, extensions := range o.categories {
-		if _, ok := extensions[ext]; ok {
+	switch o.sniffMode {
+	case SniffContentFirst:
+		if category, ok := o.categorizeByContent(path); ok {
+			return category
+		}
+		if category, ok := o.categorizeByExt(exts); ok {
+			return category
+		}
+	case SniffExtFirst:
+		if category, ok := o.categorizeByExt(exts); ok {
+			return category
+		}
+		if category, ok := o.categorizeByContent(path); ok {
+			return category
+		}
+	default:
+		if category, ok := o.categorizeByExt(exts); ok {
 			return category
 		}
 	}
@@ -329,44 +551,192 @@ func (o *Organizer) categorizeFile(path string) string {
 	return "mix"
 }
 
-func ParseSize(sizeStr string) (int64, error) {
-	if sizeStr == "" {
-		return 0, nil
+// categorizeByExt looks up the extension candidates, longest first. When
+// several categories list the same extension, categoryNames decides.
+func (o *Organizer) categorizeByExt(exts []string) (string, bool) {
+	names := o.categoryNames()
+	for _, ext := range exts {
+		for _, category := range names {
+			if _, ok := o.categories[category][ext]; ok {
+				return category, true
+			}
+		}
 	}
+	return "", false
+}
 
-	sizeStr = strings.ToUpper(strings.TrimSpace(sizeStr))
+// allCategories returns every category files can be routed to: the
+// extension categories followed by those only named by rules or MIME
+// mappings.
+func (o *Organizer) allCategories() []string {
+	names := o.categoryNames()
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		seen[name] = struct{}{}
+	}
 
-	type unitInfo struct {
-		unit string
-		mult int64
+	var extra []string
+	for _, r := range o.rules {
+		extra = append(extra, r.category)
 	}
-	units := []unitInfo{
-		{"TB", 1024 * 1024 * 1024 * 1024},
-		{"T", 1024 * 1024 * 1024 * 1024},
-		{"GB", 1024 * 1024 * 1024},
-		{"G", 1024 * 1024 * 1024},
-		{"MB", 1024 * 1024},
-		{"M", 1024 * 1024},
-		{"KB", 1024},
-		{"K", 1024},
-		{"B", 1},
+	var mimeCats []string
+	for _, catName := range o.mimeCategories {
+		mimeCats = append(mimeCats, catName)
 	}
+	sort.Strings(mimeCats)
+	extra = append(extra, mimeCats...)
 
-	for _, ui := range units {
-		if strings.HasSuffix(sizeStr, ui.unit) {
-			numStr := strings.TrimSuffix(sizeStr, ui.unit)
-			if numStr == "" {
-				return 0, fmt.Errorf("invalid size format: %s", sizeStr)
-			}
-			value, err := strconv.ParseInt(numStr, 10, 64)
+	for _, name := range extra {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// categoryNames returns the extension categories in precedence order:
+// the order they were listed in the config, then any others (such as the
+// built-in defaults) alphabetically.
+func (o *Organizer) categoryNames() []string {
+	names := make([]string, 0, len(o.categories))
+	seen := make(map[string]struct{}, len(o.categories))
+	for _, name := range o.categoryOrder {
+		if _, ok := o.categories[name]; !ok {
+			continue
+		}
+		if _, dup := seen[name]; !dup {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	var rest []string
+	for name := range o.categories {
+		if _, ok := seen[name]; !ok {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// planDest returns the directory and file name a file goes to. The
+// category's layout or template decides the directory; it is created by
+// prepareDestDir once the file is known to move there.
+func (o *Organizer) planDest(fc *fileContext) (string, string) {
+	if o.layouts[fc.category] == layoutMedia {
+		if destDir, stem, ok := o.mediaPlan(fc); ok {
+			return destDir, stem + fc.ext
+		}
+	}
+
+	t, ok := o.templates[fc.category]
+	if !ok {
+		return o.categoryDir(fc.category), o.destName(fc)
+	}
+	rel := t.expand(fc)
+	destDir := filepath.Join(o.rootPath, rel)
+	if dest, ok := o.dests[fc.category]; ok {
+		// the template's leading directory stands for the dest folder
+		_, rest, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		destDir = filepath.Join(dest, rest)
+	}
+	return destDir, o.destName(fc)
+}
+
+// categoryDir returns the folder a category's files go to: its dest,
+// else the template's leading directory or the category name in the root.
+func (o *Organizer) categoryDir(category string) string {
+	if dest, ok := o.dests[category]; ok {
+		return dest
+	}
+	if t, ok := o.templates[category]; ok {
+		return filepath.Join(o.rootPath, t.base)
+	}
+	return filepath.Join(o.rootPath, category)
+}
+
+// makeDir creates dir and any missing parents, remembering those outside
+// the root so undo can remove them again.
+func (o *Organizer) makeDir(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); !os.IsNotExist(err) || d == filepath.Dir(d) {
+			break
+		}
+		missing = append(missing, d)
+	}
+	var outside []string
+	var seqs []int
+	for _, d := range missing {
+		if !isWithin(o.rootPath, d) {
+			seq, err := o.intend(history.Op{Kind: history.OpMkdir, Path: d})
 			if err != nil {
-				return 0, fmt.Errorf("invalid size value: %s", numStr)
+				return err
 			}
-			return value * ui.mult, nil
+			outside = append(outside, d)
+			seqs = append(seqs, seq)
 		}
 	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		// some of the parents may have been made before the failure
+		for i, d := range outside {
+			if _, statErr := os.Stat(d); statErr == nil {
+				o.done(seqs[i], nil)
+				o.createdDirs = append(o.createdDirs, d)
+			} else {
+				o.fail(seqs[i], err)
+			}
+		}
+		return err
+	}
+	for i, d := range outside {
+		o.done(seqs[i], nil)
+		o.createdDirs = append(o.createdDirs, d)
+	}
+	return nil
+}
 
-	return 0, fmt.Errorf("unknown size unit in: %s", sizeStr)
+// prepareDestDir creates a destination directory below a category folder
+// the first time a file moves there, and tracks it as a target path.
+func (o *Organizer) prepareDestDir(destDir string) error {
+	if _, tracked := o.targetPaths[destDir]; tracked {
+		return nil
+	}
+	o.targetPaths[destDir] = struct{}{}
+
+	if o.dryRun {
+		log.Printf("[DRYRUN] Would create directory: %s", destDir)
+		return nil
+	}
+	if err := o.makeDir(destDir); err != nil {
+		o.logger.Error("Failed to create directory",
+			"action", "CREATE_DIR",
+			"path", destDir,
+			"error", err.Error(),
+		)
+		return fmt.Errorf("failed to create directory %s: %w", destDir, err)
+	}
+	o.logger.Info("Directory created",
+		"action", "CREATE_DIR",
+		"path", destDir,
+	)
+	return nil
+}
+
+// destName returns the file name to use at the destination, applying the
+// category's rename template while keeping the original extension.
+func (o *Organizer) destName(fc *fileContext) string {
+	t, ok := o.renames[fc.category]
+	if !ok {
+		return filepath.Base(fc.path)
+	}
+	name := sanitizeElem(t.expand(fc))
+	if name == "" || name == "_" {
+		return filepath.Base(fc.path)
+	}
+	return name + fc.ext
 }
 
 // resolveCollision appends a counter to the filename if a file already exists
@@ -378,10 +748,9 @@ func (o *Organizer) resolveCollision(path string) string {
 	}
 
 	// If it exists, start looking for _1, _2, etc.
+	// splitExt keeps compound extensions intact: backup.tar.gz -> backup_1.tar.gz
 	dir := filepath.Dir(path)
-	base := filepath.Base(path)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
+	name, ext := o.splitExt(filepath.Base(path))
 
 	counter := 1
 	for {
@@ -412,6 +781,20 @@ func (o *Organizer) moveFile(src, dst string) (int64, error) {
 	}
 
 	// Fallback for cross-device or other rename failures
+	written, err := copyFile(src, dst)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Remove(src); err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
+
+// copyFile copies src to dst, keeping its permissions and timestamps.
+func copyFile(src, dst string) (int64, error) {
 	// Get source file metadata before copy
 	srcInfo, err := os.Stat(src)
 	if err != nil {
@@ -455,16 +838,14 @@ func (o *Organizer) moveFile(src, dst string) (int64, error) {
 		return 0, fmt.Errorf("failed to preserve timestamps: %w", err)
 	}
 
-	if err := os.Remove(src); err != nil {
-		return 0, err
-	}
-
 	return written, nil
 }
 
 // Run executes the organization process
 func (o *Organizer) Run(ctx context.Context) error {
 	o.startTime = time.Now()
+	o.runID = history.NewRunID(o.startTime)
+	o.command = "organize"
 
 	// Path validation and resolution
 	absPath, err := filepath.Abs(o.rootPath)
@@ -473,18 +854,35 @@ func (o *Organizer) Run(ctx context.Context) error {
 	}
 	o.rootPath = absPath
 
+	if err := o.resolveSources(); err != nil {
+		return err
+	}
+
+	if err := o.beginJournal(); err != nil {
+		return err
+	}
+	// the journal goes only once the history has the run; an error return
+	// leaves it for recover
+	recorded := false
+	defer func() { o.endJournal(!recorded) }()
+
 	// Prepare target directories
-	requiredDirs := []string{"mix"}
-	for catName := range o.categories {
-		requiredDirs = append(requiredDirs, catName)
+	mixDir := filepath.Join(o.rootPath, "mix")
+	requiredDirs := []string{mixDir}
+	seen := map[string]struct{}{mixDir: {}}
+	for _, catName := range o.allCategories() {
+		dirPath := o.categoryDir(catName)
+		if _, ok := seen[dirPath]; !ok {
+			seen[dirPath] = struct{}{}
+			requiredDirs = append(requiredDirs, dirPath)
+		}
 	}
 
-	for _, dirName := range requiredDirs {
-		dirPath := filepath.Join(o.rootPath, dirName)
+	for _, dirPath := range requiredDirs {
 		o.targetPaths[dirPath] = struct{}{}
 
 		if !o.dryRun {
-			if mkdirErr := os.MkdirAll(dirPath, 0755); mkdirErr != nil {
+			if mkdirErr := o.makeDir(dirPath); mkdirErr != nil {
 				o.logger.Error("Failed to create directory",
 					"action", "CREATE_DIR",
 					"path", dirPath,
@@ -501,9 +899,70 @@ func (o *Organizer) Run(ctx context.Context) error {
 		}
 	}
 
-	// Walk the directory tree
+	if err := o.loadIgnores(); err != nil {
+		return fmt.Errorf("failed to load ignore file: %w", err)
+	}
+
+	o.buildDupIndex()
+
+	// Walk each source tree
 	var processedCount, errorCount int
-	err = filepath.WalkDir(o.rootPath, func(path string, d fs.DirEntry, err error) error {
+	for _, source := range o.sources {
+		if len(o.sources) > 1 {
+			log.Printf("Scanning: %s", source)
+		}
+		err = o.walkSource(ctx, source, &processedCount, &errorCount)
+		if err != nil {
+			break
+		}
+		o.settleSidecars(&errorCount)
+	}
+
+	// Cleanup logic for empty directories; copies and hardlinks leave the
+	// sources as they were
+	if o.recursive && !o.dryRun && !o.mode.keepsSource() {
+		log.Println("Cleaning up empty subdirectories...")
+		for _, source := range o.sources {
+			if cleanupErr := o.cleanupEmptyDirs(source); cleanupErr != nil {
+				log.Printf("Cleanup error: %v", cleanupErr)
+			}
+		}
+	}
+
+	executionTime := time.Since(o.startTime)
+	filesPerSecond := float64(processedCount) / executionTime.Seconds()
+	if executionTime.Seconds() == 0 {
+		filesPerSecond = float64(processedCount)
+	}
+
+	metrics := Metrics{
+		ExecutionTime:  executionTime,
+		FilesProcessed: processedCount,
+		TotalBytes:     o.totalBytes,
+		FilesPerSecond: filesPerSecond,
+		BinaryUnits:    o.binaryUnits,
+	}
+
+	fmt.Print(metrics.String())
+	o.counts.Processed = processedCount
+	o.counts.Errors = errorCount
+
+	if !o.dryRun && o.changedAnything() {
+		if historyErr := o.SaveHistory(); historyErr != nil {
+			log.Printf("Warning: failed to save history file: %v", historyErr)
+		} else {
+			recorded = true
+		}
+	} else {
+		recorded = true
+	}
+
+	return err
+}
+
+// walkSource organizes the files found in one source directory.
+func (o *Organizer) walkSource(ctx context.Context, source string, processedCount, errorCount *int) error {
+	return filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
 		// Check if context was canceled (Ctrl+C)
 		select {
 		case <-ctx.Done():
@@ -517,19 +976,23 @@ func (o *Organizer) Run(ctx context.Context) error {
 				"path", path,
 				"error", err.Error(),
 			)
-			errorCount++
+			*errorCount++
 			return nil
 		}
 
 		// Skip directories and existing target folders
 		if d.IsDir() {
-			// Never skip the root dir
-			if path == o.rootPath {
+			// Never skip the source dir itself
+			if path == source {
 				return nil
 			}
 
-			// Always skip target subdirs
-			if _, isTarget := o.targetPaths[path]; isTarget && path != o.rootPath {
+			// Always skip target subdirs, and the whole destination
+			// when it lies inside a source
+			if _, isTarget := o.targetPaths[path]; isTarget || path == o.rootPath {
+				return filepath.SkipDir
+			}
+			if path == filepath.Join(o.rootPath, history.QuarantineDir) {
 				return filepath.SkipDir
 			}
 
@@ -537,11 +1000,42 @@ func (o *Organizer) Run(ctx context.Context) error {
 				return filepath.SkipDir
 			}
 
+			if o.isIgnored(path, true) {
+				o.logIgnored(path)
+				return filepath.SkipDir
+			}
+			if err := o.loadIgnoreFile(path); err != nil {
+				log.Printf("Error reading ignore file in %s: %v", path, err)
+				o.logger.Error("Error reading ignore file",
+					"path", path,
+					"error", err.Error(),
+				)
+				*errorCount++
+			}
+
 			return nil
 		}
 
-		// Size filter check
-		if o.minSize > 0 || o.maxSize > 0 {
+		if _, ok := o.claimed[path]; ok {
+			return nil
+		}
+		if filepath.Dir(path) == o.rootPath && isStateFile(d.Name()) {
+			return nil
+		}
+		if d.Name() == ignore.FileName {
+			return nil
+		}
+		if o.isOrganizedLink(path, d) {
+			log.Printf("Skipped (link to an organized file): %s", path)
+			return nil
+		}
+		if o.isIgnored(path, false) {
+			o.logIgnored(path)
+			return nil
+		}
+
+		// Size and age filter check
+		if o.minSize > 0 || o.maxSize > 0 || !o.olderThan.IsZero() || !o.newerThan.IsZero() {
 			info, err := d.Info()
 			if err != nil {
 				log.Printf("Error getting file info for %s: %v", path, err)
@@ -566,6 +1060,9 @@ func (o *Organizer) Run(ctx context.Context) error {
 				)
 				return nil
 			}
+			if o.skipByAge(path, info) {
+				return nil
+			}
 		}
 
 		// Process individual file
@@ -575,58 +1072,31 @@ func (o *Organizer) Run(ctx context.Context) error {
 				"source", path,
 				"error", err.Error(),
 			)
-			errorCount++
+			*errorCount++
 		} else {
-			processedCount++
+			*processedCount++
 		}
 
 		return nil
 	})
-
-	// Cleanup logic for empty directories
-	if o.recursive && !o.dryRun {
-		log.Println("Cleaning up empty subdirectories...")
-		if cleanupErr := o.cleanupEmptyDirs(); cleanupErr != nil {
-			log.Printf("Cleanup error: %v", cleanupErr)
-		}
-	}
-
-	executionTime := time.Since(o.startTime)
-	filesPerSecond := float64(processedCount) / executionTime.Seconds()
-	if executionTime.Seconds() == 0 {
-		filesPerSecond = float64(processedCount)
-	}
-
-	metrics := Metrics{
-		ExecutionTime:  executionTime,
-		FilesProcessed: processedCount,
-		TotalBytes:     o.totalBytes,
-		FilesPerSecond: filesPerSecond,
-	}
-
-	fmt.Print(metrics.String())
-
-	if !o.dryRun && len(o.movedFiles) > 0 {
-		if historyErr := o.SaveHistory(); historyErr != nil {
-			log.Printf("Warning: failed to save history file: %v", historyErr)
-		}
-	}
-
-	return err
 }
 
-// cleanupEmptyDirs walks the path and removes empty folders.
-func (o *Organizer) cleanupEmptyDirs() error {
+// cleanupEmptyDirs walks a source and removes empty folders below it.
+func (o *Organizer) cleanupEmptyDirs(source string) error {
 	// We use a slice to collect paths so we can sort them or process them
 	// without interfering with the active walk.
 	var dirs []string
-	err := filepath.WalkDir(o.rootPath, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() && path != o.rootPath {
-			// Skip target folders (video, audio, etc.)
-			if _, isTarget := o.targetPaths[path]; isTarget {
+		if d.IsDir() && path != source {
+			// Skip target folders (video, audio, etc.), the destination
+			// and the quarantine
+			if _, isTarget := o.targetPaths[path]; isTarget || path == o.rootPath {
+				return filepath.SkipDir
+			}
+			if path == filepath.Join(o.rootPath, history.QuarantineDir) {
 				return filepath.SkipDir
 			}
 			dirs = append(dirs, path)
@@ -651,8 +1121,13 @@ func (o *Organizer) cleanupEmptyDirs() error {
 
 		if len(entries) == 0 {
 			log.Printf("Removing empty directory: %s", path)
+			seq, err := o.intend(history.Op{Kind: history.OpRmdir, Path: path})
+			if err != nil {
+				return err
+			}
 			o.deletedDirs = append(o.deletedDirs, path)
 			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				o.fail(seq, err)
 				o.logger.Error("Failed to remove directory",
 					"action", "DELETE_DIR",
 					"path", path,
@@ -660,6 +1135,7 @@ func (o *Organizer) cleanupEmptyDirs() error {
 				)
 				return err
 			}
+			o.done(seq, nil)
 			o.logger.Info("Directory removed",
 				"action", "DELETE_DIR",
 				"path", path,
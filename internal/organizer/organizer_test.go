@@ -1,14 +1,27 @@
 package organizer
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/riccione/fileater/internal/config"
+	"github.com/riccione/fileater/internal/filecmp"
+	"github.com/riccione/fileater/internal/hashcache"
 	"github.com/riccione/fileater/internal/history"
+	"github.com/riccione/fileater/internal/phash"
+	"github.com/riccione/fileater/internal/rollback"
 )
 
 func newTestLogger() *slog.Logger {
@@ -43,7 +56,7 @@ func TestCategorizeFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := o.categorizeFile(tt.path)
+			result := o.categorizeFile(tt.path, nil)
 			if result != tt.expected {
 				t.Errorf("categorizeFile(%s) = %s; want %s", tt.path, result, tt.expected)
 			}
@@ -51,6 +64,200 @@ func TestCategorizeFile(t *testing.T) {
 	}
 }
 
+func TestCategorizeFile_Rules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	cfg := `{
+		"version": 2,
+		"categories": {"docs": [".pdf", ".txt"]},
+		"rules": [
+			{"category": "finance", "name": "invoice_*", "ext": [".pdf"]},
+			{"category": "big", "min_size": "1KB"},
+			{"category": "stale", "older_than": "30d"},
+			{"category": "scans", "parent": "scanner*"},
+			{"category": "logs", "regex": "^app-[0-9]+\\.log$"}
+		]
+	}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, _ := NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	write := func(rel string, size int, age time.Duration) (string, os.FileInfo) {
+		path := filepath.Join(tmpDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, make([]byte, size), 0644)
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path, info
+	}
+
+	tests := []struct {
+		name     string
+		rel      string
+		size     int
+		age      time.Duration
+		expected string
+	}{
+		{"Name Glob And Ext", "INVOICE_2024.pdf", 10, 0, "finance"},
+		{"Name Glob Wrong Ext", "invoice_2024.txt", 10, 0, "docs"},
+		{"Size Range", "movie.bin", 2048, 0, "big"},
+		{"Modification Age", "old.txt", 10, 40 * 24 * time.Hour, "stale"},
+		{"Parent Directory", "scanner_out/page.txt", 10, 0, "scans"},
+		{"Regex", "app-42.log", 10, 0, "logs"},
+		{"Extension Fallback", "report.pdf", 10, 0, "docs"},
+		{"No Match", "notes.xyz", 10, 0, "mix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, info := write(tt.rel, tt.size, tt.age)
+			if result := o.categorizeFile(path, info); result != tt.expected {
+				t.Errorf("categorizeFile(%s) = %s; want %s", tt.rel, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"90s", 90 * time.Second, false},
+		{"2h", 2 * time.Hour, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"1y", 365 * 24 * time.Hour, false},
+		{"15m", 15 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"9999999999999y", 0, true},
+		{"d", 0, true},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseAge(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAge(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("ParseAge(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCategorizeFile_Sniff(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	pdf := []byte("%PDF-1.7\n")
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	extensionless := write("download", pdf)
+	mislabeled := write("picture.bin", png)
+	wrongExt := write("photo.txt", png)
+
+	o, _ := NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+	o.categories = map[string]map[string]struct{}{
+		"docs":   {".pdf": {}, ".txt": {}},
+		"images": {".png": {}},
+	}
+	o.mimeCategories = map[string]string{"image/*": "pictures"}
+
+	tests := []struct {
+		name     string
+		mode     SniffMode
+		path     string
+		expected string
+	}{
+		{"Off Ignores Content", SniffOff, extensionless, "mix"},
+		{"Ext First Extensionless", SniffExtFirst, extensionless, "docs"},
+		{"Ext First Mislabeled", SniffExtFirst, mislabeled, "pictures"},
+		{"Ext First Trusts Known Ext", SniffExtFirst, wrongExt, "docs"},
+		{"Content First Overrides Ext", SniffContentFirst, wrongExt, "pictures"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o.SetSniffMode(tt.mode)
+			if result := o.categorizeFile(tt.path, nil); result != tt.expected {
+				t.Errorf("categorizeFile(%s) = %s; want %s", filepath.Base(tt.path), result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSniffMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected SniffMode
+		wantErr  bool
+	}{
+		{"", SniffOff, false},
+		{"off", SniffOff, false},
+		{"ext-first", SniffExtFirst, false},
+		{"Content-First", SniffContentFirst, false},
+		{"always", SniffOff, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseSniffMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSniffMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if result != tt.expected {
+				t.Errorf("ParseSniffMode(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCategorizeFile_Precedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	cfg := `{"notes": [".txt", ".md"], "docs": [".txt", ".pdf"], "archive": [".md"]}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Map iteration order varies between runs, so repeat to catch flakiness
+	for i := 0; i < 20; i++ {
+		o, _ := NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+		if err := o.LoadConfig(configPath); err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if result := o.categorizeFile("todo.txt", nil); result != "notes" {
+			t.Fatalf("categorizeFile(todo.txt) = %s; want notes (listed first)", result)
+		}
+		if result := o.categorizeFile("README.md", nil); result != "notes" {
+			t.Fatalf("categorizeFile(README.md) = %s; want notes (listed first)", result)
+		}
+	}
+}
+
 func TestResolveCollision(t *testing.T) {
 	// Create a temporary directory unique to this test run
 	tmpDir := t.TempDir()
@@ -79,6 +286,80 @@ func TestResolveCollision(t *testing.T) {
 	}
 }
 
+func TestResolveCollision_CompoundExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+
+	path := filepath.Join(tmpDir, "backup.tar.gz")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := filepath.Join(tmpDir, "backup_1.tar.gz")
+	if result := o.resolveCollision(path); result != expected {
+		t.Errorf("Expected collision path %s, got %s", expected, result)
+	}
+}
+
+func TestSplitExt(t *testing.T) {
+	o, _ := NewOrganizer(".", true, false, newTestLogger(), "", "", false)
+	o.categories = map[string]map[string]struct{}{
+		"archives": {".tar.gz": {}, ".tar.custom": {}},
+	}
+
+	tests := []struct {
+		name string
+		stem string
+		ext  string
+	}{
+		{"backup.tar.gz", "backup", ".tar.gz"},
+		{"Backup.TAR.GZ", "Backup", ".TAR.GZ"},
+		{"logs.tar.zst", "logs", ".tar.zst"},
+		{"site.tar.custom", "site", ".tar.custom"},
+		{"script.user.js", "script", ".user.js"},
+		{"movie.part1.rar", "movie", ".part1.rar"},
+		{"my.holiday.photo.jpg", "my.holiday.photo", ".jpg"},
+		{"report.pdf", "report", ".pdf"},
+		{"README", "README", ""},
+		{".bashrc", "", ".bashrc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stem, ext := o.splitExt(tt.name)
+			if stem != tt.stem || ext != tt.ext {
+				t.Errorf("splitExt(%s) = (%q, %q); want (%q, %q)", tt.name, stem, ext, tt.stem, tt.ext)
+			}
+		})
+	}
+}
+
+func TestCategorizeFile_CompoundExtension(t *testing.T) {
+	o, _ := NewOrganizer(".", true, false, newTestLogger(), "", "", false)
+	o.categories = map[string]map[string]struct{}{
+		"archives":   {".tar.gz": {}, ".zip": {}},
+		"compressed": {".gz": {}},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"backup.tar.gz", "archives"},
+		{"BACKUP.TAR.GZ", "archives"},
+		{"access.log.gz", "compressed"},
+		{"data.tar.xz", "mix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if result := o.categorizeFile(tt.path, nil); result != tt.expected {
+				t.Errorf("categorizeFile(%s) = %s; want %s", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestRun_CreatesDirectories(t *testing.T) {
 	// Setup a clean environment
 	tmpDir := t.TempDir()
@@ -114,6 +395,785 @@ func TestRun_CreatesDirectories(t *testing.T) {
 	}
 }
 
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		base    string
+		wantErr bool
+	}{
+		{"images/{mtime:2006}/{mtime:01}", "images", false},
+		{"docs/{ext}", "docs", false},
+		{"archives/{size_bucket}", "archives", false},
+		{"sorted/{category}", "sorted", false},
+		{"", "", true},
+		{"/abs/{ext}", "", true},
+		{"{ext}/docs", "", true},
+		{"docs/{nope}", "", true},
+		{"docs/{mtime}", "", true},
+		{"images/{taken:2006}/{camera}", "images", false},
+		{"docs/{ext:x}", "", true},
+		{"docs/{ext", "", true},
+		{"docs/ext}", "", true},
+		{"docs/../{ext}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			tmpl, err := parseDestTemplate(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDestTemplate(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if !tt.wantErr && tmpl.base != tt.base {
+				t.Errorf("parseDestTemplate(%q).base = %q, want %q", tt.raw, tmpl.base, tt.base)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate_LayoutStaysInside(t *testing.T) {
+	mtime := time.Date(2023, time.March, 14, 12, 0, 0, 0, time.Local)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.jpg")
+	os.WriteFile(path, []byte("x"), 0644)
+	os.Chtimes(path, mtime, mtime)
+	info, _ := os.Stat(path)
+
+	o, _ := NewOrganizer(dir, true, false, newTestLogger(), "", "", false)
+	fc := o.newFileContext("images", path, info)
+
+	tests := map[string]string{
+		"images/{mtime:2006/01}":         "images/2023/03",
+		"images/{mtime:..}/{mtime:2006}": "images/_/2023",
+		"images/{taken:2006/..}":         "images/2023/_",
+		"images/{mtime:2006\\..\\01}":    "images/2023/_/03",
+	}
+	for raw, want := range tests {
+		tmpl, err := parseDestTemplate(raw)
+		if err != nil {
+			t.Fatalf("parseDestTemplate(%q): %v", raw, err)
+		}
+		got := tmpl.expand(fc)
+		if got != want {
+			t.Errorf("expand(%q) = %q, want %q", raw, got, want)
+		}
+		if rel, _ := filepath.Rel("images", got); strings.HasPrefix(rel, "..") {
+			t.Errorf("expand(%q) = %q escapes the category folder", raw, got)
+		}
+	}
+}
+
+func TestRun_DestinationTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{
+		"images": {"ext": [".jpg"], "template": "images/{mtime:2006}/{mtime:01}"},
+		"docs": {"ext": [".pdf", ".txt"], "template": "docs/{ext}"},
+		"archives": {"ext": [".tar.gz"], "template": "archives/{size_bucket}"}
+	}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2023, time.March, 14, 12, 0, 0, 0, time.Local)
+	for _, name := range []string{"photo.jpg", "report.pdf", "notes.txt", "backup.tar.gz"} {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("images", "2023", "03", "photo.jpg"),
+		filepath.Join("docs", "pdf", "report.pdf"),
+		filepath.Join("docs", "txt", "notes.txt"),
+		filepath.Join("archives", "small", "backup.tar.gz"),
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+
+	expandedDir := filepath.Join(tmpDir, "images", "2023", "03")
+	if _, ok := o.targetPaths[expandedDir]; !ok {
+		t.Errorf("expanded directory %s should be tracked as a target path", expandedDir)
+	}
+
+	// A second recursive run must leave the organized tree alone
+	o2, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+	if err := o2.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o2.Run(context.Background()); err != nil {
+		t.Fatalf("second Run failed: %v", err)
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("second run moved %s: %v", rel, err)
+		}
+	}
+}
+
+// exifJPEG builds a minimal JPEG whose EXIF block holds only the camera
+// make and the DateTime tag in IFD0.
+func exifJPEG(taken, camMake string) []byte {
+	le := binary.LittleEndian
+	makeB, takenB := append([]byte(camMake), 0), append([]byte(taken), 0)
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	dataOff := uint32(8 + 2 + 2*12 + 4)
+	binary.Write(&tiff, le, uint16(2))
+	for _, e := range []struct {
+		tag uint16
+		val []byte
+		off uint32
+	}{
+		{0x010F, makeB, dataOff},
+		{0x0132, takenB, dataOff + uint32(len(makeB))},
+	} {
+		binary.Write(&tiff, le, e.tag)
+		binary.Write(&tiff, le, uint16(2))
+		binary.Write(&tiff, le, uint32(len(e.val)))
+		binary.Write(&tiff, le, e.off)
+	}
+	binary.Write(&tiff, le, uint32(0))
+	tiff.Write(makeB)
+	tiff.Write(takenB)
+
+	var jpg bytes.Buffer
+	jpg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&jpg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpg.WriteString("Exif\x00\x00")
+	jpg.Write(tiff.Bytes())
+	jpg.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return jpg.Bytes()
+}
+
+func TestRun_ExifTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{
+		"images": {
+			"ext": [".jpg"],
+			"template": "images/{taken:2006}/{taken:2006-01-02}",
+			"rename": "IMG_{taken:20060102_150405}"
+		}
+	}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withExif := filepath.Join(tmpDir, "DSC0001.jpg")
+	os.WriteFile(withExif, exifJPEG("2024:06:12 14:35:01", "Canon"), 0644)
+
+	// No EXIF: falls back to the modification time
+	noExif := filepath.Join(tmpDir, "screenshot.JPG")
+	os.WriteFile(noExif, []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0644)
+	mtime := time.Date(2022, time.January, 2, 3, 4, 5, 0, time.Local)
+	os.Chtimes(noExif, mtime, mtime)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("images", "2024", "2024-06-12", "IMG_20240612_143501.jpg"),
+		filepath.Join("images", "2022", "2022-01-02", "IMG_20220102_030405.JPG"),
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+
+	// Undo history must point back at the original names
+	if orig := o.movedFiles[filepath.Join(tmpDir, expected[0])]; orig != withExif {
+		t.Errorf("history maps renamed photo to %q, want %q", orig, withExif)
+	}
+}
+
+// id3File builds an MP3 stub with an ID3v2.3 tag holding the given text
+// frames, e.g. "TPE1" => "Artist".
+func id3File(frames map[string]string) []byte {
+	var body bytes.Buffer
+	for id, text := range frames {
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(text)+1))
+		body.Write([]byte{0, 0, 0})
+		body.WriteString(text)
+	}
+	n := body.Len()
+	out := []byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	out = append(out, body.Bytes()...)
+	return append(out, 0xFF, 0xFB, 0x90, 0x64)
+}
+
+func TestRun_MusicLibraryLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{
+		"audio": {
+			"ext": [".mp3"],
+			"template": "audio/{artist}/{album}",
+			"rename": "{track:02} - {title}"
+		}
+	}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := filepath.Join(tmpDir, "track5.mp3")
+	os.WriteFile(tagged, id3File(map[string]string{
+		"TPE1": "AC/DC",
+		"TALB": "Back in Black",
+		"TIT2": "What Do You Do for Money Honey?",
+		"TRCK": "5/10",
+	}), 0644)
+	untagged := filepath.Join(tmpDir, "voice memo.mp3")
+	os.WriteFile(untagged, []byte{0xFF, 0xFB, 0x90, 0x64}, 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("audio", "AC_DC", "Back in Black", "05 - What Do You Do for Money Honey_.mp3"),
+		filepath.Join("audio", "Unknown Artist", "Unknown Album", "00 - voice memo.mp3"),
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+
+	// The moves are recorded like any other, so undo restores them
+	if err := rollback.Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, path := range []string{tagged, untagged} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("undo did not restore %s: %v", path, err)
+		}
+	}
+}
+
+func TestRun_MediaLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{"video": {"ext": [".mkv", ".mp4"], "layout": "media"}}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		"Show.Name.S02E05.1080p.WEB.mkv",
+		"Show.Name.S02E05.1080p.WEB.en.srt",
+		"Title.2019.1080p.BluRay.x264.mkv",
+		"Title.2019.1080p.BluRay.x264.ass",
+		"holiday.mp4",
+		"holiday.srt",
+		"Birthday party 2019-05-04.mp4",
+		"orphan.srt",
+	}
+	for _, name := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	// An episode already in the library forces a collision rename
+	existing := filepath.Join(tmpDir, "video", "TV", "Show Name", "Season 02", "Show Name - S02E05.mkv")
+	os.MkdirAll(filepath.Dir(existing), 0755)
+	os.WriteFile(existing, []byte("older copy"), 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("video", "TV", "Show Name", "Season 02", "Show Name - S02E05_1.mkv"),
+		filepath.Join("video", "TV", "Show Name", "Season 02", "Show Name - S02E05_1.en.srt"),
+		filepath.Join("video", "Movies", "Title (2019)", "Title (2019).mkv"),
+		filepath.Join("video", "Movies", "Title (2019)", "Title (2019).ass"),
+		filepath.Join("video", "holiday.mp4"),
+		filepath.Join("video", "holiday.srt"),
+		filepath.Join("video", "Birthday party 2019-05-04.mp4"),
+		filepath.Join("mix", "orphan.srt"),
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+
+	if err := rollback.Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("undo did not restore %s: %v", name, err)
+		}
+	}
+}
+
+func TestRun_SidecarGroups(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{
+		"version": 2,
+		"categories": {
+			"images": [".nef"],
+			"video": [".mkv"],
+			"maps": [".shp"],
+			"discs": [".cue"]
+		},
+		"sidecars": [
+			{"ext": [".srt", ".xmp"]},
+			{"primary": [".shp"], "ext": [".shx", ".dbf", ".prj"]},
+			{"primary": [".cue"], "ext": [".bin"]}
+		]
+	}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		"DSC001.NEF", "DSC001.NEF.xmp",
+		"movie.mkv", "movie.en.srt", "movie.srt",
+		"roads.shp", "roads.shx", "roads.dbf", "roads.prj",
+		"game.cue", "game.bin",
+		"firmware.bin",
+	}
+	for _, name := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	// Only the subtitle collides, yet the whole group gets the counter
+	os.MkdirAll(filepath.Join(tmpDir, "video"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "video", "movie.en.srt"), []byte("other"), 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("images", "DSC001.NEF"),
+		filepath.Join("images", "DSC001.NEF.xmp"),
+		filepath.Join("video", "movie_1.mkv"),
+		filepath.Join("video", "movie_1.en.srt"),
+		filepath.Join("video", "movie_1.srt"),
+		filepath.Join("maps", "roads.shp"),
+		filepath.Join("maps", "roads.shx"),
+		filepath.Join("maps", "roads.dbf"),
+		filepath.Join("maps", "roads.prj"),
+		filepath.Join("discs", "game.cue"),
+		filepath.Join("discs", "game.bin"),
+		filepath.Join("mix", "firmware.bin"),
+	}
+	for _, rel := range expected {
+		if _, err := os.Stat(filepath.Join(tmpDir, rel)); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+
+	if err := rollback.Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("undo did not restore %s: %v", name, err)
+		}
+	}
+}
+
+func TestRun_IgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		".fileaterignore":     "*.part\nkeep/\n/notes.txt\n",
+		"movie.part":          "",
+		"song.mp3":            "",
+		"notes.txt":           "",
+		"report.pdf":          "",
+		"draft.pdf":           "",
+		"keep/a.mp3":          "",
+		"sub/.fileaterignore": "!*.part\n",
+		"sub/notes.txt":       "",
+		"sub/video.part":      "",
+		"sub/deep/other.part": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if content == "" {
+			// distinct content so nothing is treated as a duplicate
+			content = name
+		}
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	o, _ := NewOrganizer(tmpDir, false, true, logger, "", "", false)
+	o.UseDefaultCategories()
+	if err := o.SetFilters([]string{"*.pdf"}, []string{"report.pdf"}); err != nil {
+		t.Fatalf("SetFilters failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	stayed := []string{
+		".fileaterignore", "movie.part", "notes.txt", "draft.pdf",
+		"keep/a.mp3", "sub/.fileaterignore",
+	}
+	for _, rel := range stayed {
+		if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s to stay: %v", rel, err)
+		}
+	}
+	moved := []string{
+		"audio/song.mp3", "docs/report.pdf", "docs/notes.txt",
+		"mix/video.part", "mix/other.part",
+	}
+	for _, rel := range moved {
+		if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s to be moved: %v", rel, err)
+		}
+	}
+
+	if !strings.Contains(buf.String(), "action=SKIP_IGNORED") {
+		t.Error("expected SKIP_IGNORED entries in the log")
+	}
+
+	o2, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o2.SetFilters([]string{"bad["}, nil); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRun_MultipleSourcesIntoDest(t *testing.T) {
+	downloads := t.TempDir()
+	desktop := t.TempDir()
+	// The destination may live inside a source; it is never rescanned
+	dest := filepath.Join(downloads, "Sorted")
+
+	files := map[string]string{
+		filepath.Join(downloads, "song.mp3"):            "song",
+		filepath.Join(downloads, "report.pdf"):          "report from downloads",
+		filepath.Join(desktop, "report.pdf"):            "report from desktop",
+		filepath.Join(desktop, "clips", "movie.mp4"):    "movie",
+		filepath.Join(desktop, "clips", "movie.en.srt"): "subs",
+	}
+	for path, content := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	o, _ := NewOrganizer(dest, false, true, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	o.SetSources(downloads, desktop, downloads)
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dest, "audio", "song.mp3"),
+		filepath.Join(dest, "docs", "report.pdf"),
+		filepath.Join(dest, "docs", "report_1.pdf"),
+		filepath.Join(dest, "video", "movie.mp4"),
+		filepath.Join(dest, "video", "movie.en.srt"),
+	}
+	for _, path := range expected {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(desktop, "clips")); !os.IsNotExist(err) {
+		t.Errorf("emptied source subdirectory should have been removed")
+	}
+
+	runs, err := history.Load(dest)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("history not written to the destination: %d runs, %v", len(runs), err)
+	}
+	state := runs[0].State
+	if len(state.SourceRoots) != 2 {
+		t.Errorf("SourceRoots = %v; want both sources once", state.SourceRoots)
+	}
+	if got := state.Sources[filepath.Join(dest, "audio", "song.mp3")]; got != downloads {
+		t.Errorf("song.mp3 recorded from %q; want %q", got, downloads)
+	}
+	if got := state.Sources[filepath.Join(dest, "video", "movie.en.srt")]; got != desktop {
+		t.Errorf("movie.en.srt recorded from %q; want %q", got, desktop)
+	}
+
+	if err := rollback.Undo(dest, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for path, content := range files {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("undo did not restore %s: %v", path, err)
+		}
+	}
+}
+
+func TestRun_InvalidSource(t *testing.T) {
+	o, _ := NewOrganizer(t.TempDir(), false, false, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	o.SetSources(filepath.Join(t.TempDir(), "missing"))
+	if err := o.Run(context.Background()); err == nil {
+		t.Error("expected an error for a missing source")
+	}
+}
+
+func TestRun_CategoryDestinations(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	share := filepath.Join(t.TempDir(), "srv", "share", "docs")
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := fmt.Sprintf(`{
+		"version": 2,
+		"categories": {
+			"images": {"ext": [".jpg"], "dest": "~/Pictures/Inbox"},
+			"docs": {"ext": [".pdf"], "dest": %q, "template": "docs/{ext}"},
+			"audio": [".mp3"]
+		}
+	}`, share)
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{"photo.jpg", "report.pdf", "song.mp3"}
+	for _, name := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(home, "Pictures", "Inbox", "photo.jpg"),
+		filepath.Join(share, "pdf", "report.pdf"),
+		filepath.Join(tmpDir, "audio", "song.mp3"),
+	}
+	for _, path := range expected {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "images")); !os.IsNotExist(err) {
+		t.Error("no images folder should be created in the root")
+	}
+
+	if err := rollback.Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("undo did not restore %s: %v", name, err)
+		}
+	}
+	// Folders the run created outside the root are gone again
+	for _, dir := range []string{filepath.Join(home, "Pictures"), filepath.Dir(filepath.Dir(share))} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed by undo", dir)
+		}
+	}
+}
+
+func TestLoadConfig_RelativeDest(t *testing.T) {
+	o, _ := NewOrganizer(".", true, false, newTestLogger(), "", "", false)
+	cfg := &config.Config{
+		Order:      []string{"images"},
+		Categories: map[string]config.Category{"images": {Ext: []string{".jpg"}, Dest: "Pictures"}},
+	}
+	if err := o.ApplyConfig(cfg); err == nil {
+		t.Error("expected an error for a relative dest")
+	}
+}
+
+func TestRun_TransferModes(t *testing.T) {
+	tests := []struct {
+		mode       TransferMode
+		keepSource bool
+		linkSource bool
+	}{
+		{ModeMove, false, false},
+		{ModeCopy, true, false},
+		{ModeHardlink, true, false},
+		{ModeSymlink, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			src := filepath.Join(tmpDir, "sub", "report.pdf")
+			os.MkdirAll(filepath.Dir(src), 0755)
+			os.WriteFile(src, []byte("report"), 0644)
+
+			o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+			o.UseDefaultCategories()
+			o.SetTransferMode(tt.mode)
+			if err := o.Run(context.Background()); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			dest := filepath.Join(tmpDir, "docs", "report.pdf")
+			if data, err := os.ReadFile(dest); err != nil || string(data) != "report" {
+				t.Fatalf("destination not in place: %v", err)
+			}
+			fi, err := os.Lstat(src)
+			switch {
+			case tt.keepSource && (err != nil || !fi.Mode().IsRegular()):
+				t.Errorf("original should stay in place: %v", err)
+			case tt.linkSource && (err != nil || fi.Mode()&os.ModeSymlink == 0):
+				t.Errorf("original should be a symlink: %v", err)
+			case !tt.keepSource && !tt.linkSource && !os.IsNotExist(err):
+				t.Errorf("original should be gone")
+			}
+			if tt.mode == ModeHardlink {
+				srcInfo, _ := os.Stat(src)
+				destInfo, _ := os.Stat(dest)
+				if !os.SameFile(srcInfo, destInfo) {
+					t.Error("hardlink should share the original's data")
+				}
+			}
+
+			// A second run leaves the links and copies alone
+			o2, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+			o2.UseDefaultCategories()
+			o2.SetTransferMode(tt.mode)
+			if err := o2.Run(context.Background()); err != nil {
+				t.Fatalf("second Run failed: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "docs", "report_1.pdf")); err == nil {
+				t.Error("second run should not organize the same file again")
+			}
+
+			if err := rollback.Undo(tmpDir, false); err != nil {
+				t.Fatalf("Undo failed: %v", err)
+			}
+			fi, err = os.Lstat(src)
+			if err != nil || !fi.Mode().IsRegular() {
+				t.Fatalf("undo should leave the original as a regular file: %v", err)
+			}
+			if data, _ := os.ReadFile(src); string(data) != "report" {
+				t.Errorf("original content changed: %q", data)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("undo should remove %s", dest)
+			}
+		})
+	}
+}
+
+func TestParseTransferMode(t *testing.T) {
+	for input, want := range map[string]TransferMode{
+		"": ModeMove, "move": ModeMove, "Copy": ModeCopy, "hardlink": ModeHardlink, "symlink": ModeSymlink,
+	} {
+		if got, err := ParseTransferMode(input); err != nil || got != want {
+			t.Errorf("ParseTransferMode(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseTransferMode("teleport"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestLoadConfig_UnknownLayout(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{"video": {"ext": [".mkv"], "layout": "plex"}}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, _ := NewOrganizer(".", true, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err == nil {
+		t.Fatal("expected error for unknown layout")
+	}
+}
+
+func TestLoadConfig_InvalidTemplate(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{"docs": {"ext": [".pdf"], "template": "docs/{author}"}}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, _ := NewOrganizer(".", true, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err == nil {
+		t.Fatal("expected error for unknown template placeholder")
+	}
+}
+
+func TestLoadConfigChain(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tmpDir := t.TempDir()
+
+	// Without any config file the defaults apply
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfigChain(""); err != nil {
+		t.Fatalf("LoadConfigChain failed: %v", err)
+	}
+	if _, ok := o.categories["video"]; !ok {
+		t.Errorf("expected default categories, got %v", o.categories)
+	}
+
+	rootConfig := filepath.Join(tmpDir, ".fileater.json")
+	os.WriteFile(rootConfig, []byte(`{"notes": [".txt"]}`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "todo.txt"), []byte("x"), 0644)
+
+	o, _ = NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfigChain(""); err != nil {
+		t.Fatalf("LoadConfigChain failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "notes", "todo.txt")); err != nil {
+		t.Errorf("root config was not applied: %v", err)
+	}
+	if _, err := os.Stat(rootConfig); err != nil {
+		t.Errorf("root config should stay in place: %v", err)
+	}
+
+	o, _ = NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfigChain(filepath.Join(tmpDir, "missing.json")); err == nil {
+		t.Error("expected error for a missing --config file")
+	}
+}
+
 func TestMoveFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
@@ -184,7 +1244,8 @@ func TestRun_CleanupEmptyDirs(t *testing.T) {
 	staySub := filepath.Join(keepSub, "important_stuff")
 	os.Mkdir(staySub, 0755)
 	// Put a file in the nested dir so it stays non-empty
-	os.WriteFile(filepath.Join(staySub, "keep.me"), []byte("data"), 0644)
+	// (with its own content, or test.txt would be its duplicate)
+	os.WriteFile(filepath.Join(staySub, "keep.me"), []byte("keep"), 0644)
 
 	o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
 	o.UseDefaultCategories()
@@ -213,28 +1274,48 @@ func TestRun_CleanupEmptyDirs(t *testing.T) {
 func TestParseSize(t *testing.T) {
 	tests := []struct {
 		input    string
+		binary   bool
 		expected int64
 		wantErr  bool
 	}{
-		{"", 0, false},
-		{"0B", 0, false},
-		{"100B", 100, false},
-		{"1KB", 1024, false},
-		{"1K", 1024, false},
-		{"1MB", 1024 * 1024, false},
-		{"1M", 1024 * 1024, false},
-		{"1GB", 1024 * 1024 * 1024, false},
-		{"1G", 1024 * 1024 * 1024, false},
-		{"1TB", 1024 * 1024 * 1024 * 1024, false},
-		{"1T", 1024 * 1024 * 1024 * 1024, false},
-		{"512MB", 512 * 1024 * 1024, false},
-		{"invalid", 0, true},
-		{"KB", 0, true},
+		{"", false, 0, false},
+		{"0B", false, 0, false},
+		{"100B", false, 100, false},
+		{"1kB", false, 1000, false},
+		{"1KB", false, 1000, false},
+		{"1K", false, 1000, false},
+		{"1MB", false, 1000 * 1000, false},
+		{"1.5GB", false, 1500 * 1000 * 1000, false},
+		{"1TB", false, 1000 * 1000 * 1000 * 1000, false},
+		{"2PB", false, 2 * 1000 * 1000 * 1000 * 1000 * 1000, false},
+		{"1KiB", false, 1024, false},
+		{"1.5MiB", false, 1536 * 1024, false},
+		{"512mib", false, 512 * 1024 * 1024, false},
+		{"1GiB", false, 1024 * 1024 * 1024, false},
+		{"1TiB", false, 1024 * 1024 * 1024 * 1024, false},
+		{"1PiB", false, 1 << 50, false},
+		{".5kB", false, 500, false},
+		{"1.2345kB", false, 1235, false},
+		{"10 MB", false, 10 * 1000 * 1000, false},
+		{"1KB", true, 1024, false},
+		{"1M", true, 1024 * 1024, false},
+		{"1.5GB", true, 1536 * 1024 * 1024, false},
+		{"512MB", true, 512 * 1024 * 1024, false},
+		{"1MiB", true, 1024 * 1024, false},
+		{"8191PiB", false, 8191 << 50, false},
+		{"8192PiB", false, 0, true},
+		{"99999999999999999999B", false, 0, true},
+		{"invalid", false, 0, true},
+		{"KB", false, 0, true},
+		{"100", false, 0, true},
+		{"1.5XB", false, 0, true},
+		{"-1MB", false, 0, true},
+		{"1..5MB", false, 0, true},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result, err := ParseSize(tt.input)
+		t.Run(fmt.Sprintf("%s binary=%v", tt.input, tt.binary), func(t *testing.T) {
+			result, err := ParseSize(tt.input, tt.binary)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
 				return
@@ -246,6 +1327,55 @@ func TestParseSize(t *testing.T) {
 	}
 }
 
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		binary   bool
+		expected string
+	}{
+		{0, false, "0 B"},
+		{999, false, "999 B"},
+		{1500, false, "1.50 kB"},
+		{1500 * 1000 * 1000, false, "1.50 GB"},
+		{1 << 62, false, "4.61 EB"},
+		{1023, true, "1023 B"},
+		{1536, true, "1.50 KiB"},
+		{1536 * 1024 * 1024, true, "1.50 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatSize(tt.bytes, tt.binary); got != tt.expected {
+			t.Errorf("FormatSize(%d, binary=%v) = %q, want %q", tt.bytes, tt.binary, got, tt.expected)
+		}
+	}
+}
+
+func TestNewOrganizer_BinaryUnits(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	cfg := `{"version": 2, "rules": [{"category": "big", "min_size": "1KB"}]}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, binary := range []bool{false, true} {
+		want := int64(1000)
+		if binary {
+			want = 1024
+		}
+		o, err := NewOrganizer(tmpDir, true, false, newTestLogger(), "1KB", "", binary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.LoadConfig(configPath); err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if o.minSize != want || o.rules[0].minSize != want {
+			t.Errorf("binary=%v: min-size %d, rule min_size %d; want %d", binary, o.minSize, o.rules[0].minSize, want)
+		}
+	}
+}
+
 func TestRun_MinSizeFilter(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -315,6 +1445,81 @@ func TestRun_SizeRangeFilter(t *testing.T) {
 	}
 }
 
+func TestParseAgeLimit(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		cutoff  time.Time
+		wantErr bool
+	}{
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"30d", now.Add(-30 * 24 * time.Hour), false},
+		{"2024-01-31T18:00:00Z", time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC), false},
+		{"2024-01-31T18:00:00+01:00", time.Date(2024, 1, 31, 17, 0, 0, 0, time.UTC), false},
+		{"2024-01-31", time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local), false},
+		{"2024-13-01", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			limit, err := ParseAgeLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAgeLimit(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !limit.Cutoff(now).Equal(tt.cutoff) {
+				t.Errorf("ParseAgeLimit(%q) cutoff = %v, want %v", tt.input, limit.Cutoff(now), tt.cutoff)
+			}
+		})
+	}
+}
+
+func TestRun_AgeFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+
+	ages := map[string]time.Duration{
+		"fresh.txt":   time.Hour,
+		"recent.txt":  10 * 24 * time.Hour,
+		"ancient.txt": 400 * 24 * time.Hour,
+	}
+	for name, age := range ages {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	o, _ := NewOrganizer(tmpDir, false, false, logger, "", "", false)
+	o.UseDefaultCategories()
+	if err := o.SetAgeFilters("1d", "1y"); err != nil {
+		t.Fatalf("SetAgeFilters failed: %v", err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs", "recent.txt")); err != nil {
+		t.Errorf("recent.txt should have been moved: %v", err)
+	}
+	for _, name := range []string{"fresh.txt", "ancient.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("%s should have been skipped: %v", name, err)
+		}
+	}
+	if got := strings.Count(buf.String(), "action=SKIP_AGE"); got != 2 {
+		t.Errorf("expected 2 SKIP_AGE entries, got %d", got)
+	}
+
+	if err := o.SetAgeFilters("1y", "1d"); err == nil {
+		t.Error("expected an error for an empty age range")
+	}
+	if err := o.SetAgeFilters("soon", ""); err == nil {
+		t.Error("expected an error for an invalid age")
+	}
+}
+
 func TestDuplicateDetection(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -362,7 +1567,8 @@ func TestDuplicateDetection_DeleteDuplicates(t *testing.T) {
 	duplicateFile := filepath.Join(tmpDir, "dup.txt")
 	os.WriteFile(duplicateFile, content, 0644)
 
-	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", true)
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.SetDupeAction(DupeQuarantine)
 	o.categories = map[string]map[string]struct{}{
 		"docs": {".txt": {}},
 	}
@@ -372,9 +1578,440 @@ func TestDuplicateDetection_DeleteDuplicates(t *testing.T) {
 	}
 
 	if _, err := os.Stat(duplicateFile); os.IsNotExist(err) {
-		t.Log("Duplicate source file was deleted as expected")
+		t.Log("Duplicate source file was set aside as expected")
 	} else {
-		t.Error("Duplicate source file was not deleted when deleteDupes is enabled")
+		t.Error("Duplicate source file was not set aside by the quarantine action")
+	}
+}
+
+func TestDuplicateDetection_AcrossCategories(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// The twin of notes.txt sits in another category folder
+	os.MkdirAll(filepath.Join(tmpDir, "mix"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "mix", "notes.bak"), []byte("notes"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("notes"), 0644)
+	// Two identical files in the source set
+	os.MkdirAll(filepath.Join(tmpDir, "a"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "b"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "a", "song.mp3"), []byte("same song"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b", "track.mp3"), []byte("same song"), 0644)
+	// Same size, different content
+	os.WriteFile(filepath.Join(tmpDir, "other.txt"), []byte("NOTES"), 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs", "notes.txt")); err == nil {
+		t.Error("notes.txt duplicates mix/notes.bak and should not be moved")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs", "other.txt")); err != nil {
+		t.Errorf("other.txt is not a duplicate and should be moved: %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(tmpDir, "audio"))
+	if len(entries) != 1 {
+		t.Errorf("expected one copy of the song in audio/, found %d", len(entries))
+	}
+}
+
+func TestRun_SidecarOfSkippedPrimary(t *testing.T) {
+	tmpDir := t.TempDir()
+	movie := strings.Repeat("m", 200)
+	files := map[string]string{
+		// too small to move, so its subtitle stays with it
+		"short.mkv":    "tiny",
+		"short.en.srt": strings.Repeat("s", 200),
+		// a duplicate set aside, so its subtitle is organized alone
+		"video/kept.mkv": movie,
+		"copy.mkv":       movie,
+		"copy.en.srt":    strings.Repeat("c", 200),
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	o, _ := NewOrganizer(tmpDir, false, false, logger, "100B", "", false)
+	o.UseDefaultCategories()
+	o.SetDupeAction(DupeQuarantine)
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	for _, rel := range []string{"short.mkv", "short.en.srt", "mix/copy.en.srt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s to exist: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "copy.en.srt")); !os.IsNotExist(err) {
+		t.Error("the subtitle of a quarantined duplicate should not be left behind")
+	}
+	if !strings.Contains(buf.String(), "action=SKIP_SIDECAR") {
+		t.Error("expected a SKIP_SIDECAR entry for the subtitle left in place")
+	}
+}
+
+func TestRun_SidecarMoveFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "movie.mkv"), []byte("movie"), 0644)
+	// a dangling link cannot be copied
+	srt := filepath.Join(tmpDir, "movie.srt")
+	if err := os.Symlink(filepath.Join(tmpDir, "missing"), srt); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	o.SetTransferMode(ModeCopy)
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "video", "movie.mkv")); err != nil {
+		t.Errorf("expected the movie to be copied: %v", err)
+	}
+	if _, claimed := o.claimed[srt]; claimed {
+		t.Error("a sidecar that failed to copy should not be claimed")
+	}
+	if o.counts.Errors != 1 {
+		t.Errorf("errors = %d; want 1", o.counts.Errors)
+	}
+}
+
+func TestRun_DupeActions(t *testing.T) {
+	for _, action := range []DupeAction{DupeQuarantine, DupeTrash, DupeHardlink} {
+		t.Run(action.String(), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+			kept := filepath.Join(tmpDir, "docs", "original.txt")
+			dup := filepath.Join(tmpDir, "sub", "copy.txt")
+			os.MkdirAll(filepath.Dir(kept), 0755)
+			os.MkdirAll(filepath.Dir(dup), 0755)
+			os.WriteFile(kept, []byte("same text"), 0644)
+			os.WriteFile(dup, []byte("same text"), 0600)
+
+			o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+			o.UseDefaultCategories()
+			o.SetDupeAction(action)
+			if err := o.Run(context.Background()); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			switch action {
+			case DupeQuarantine:
+				stored := filepath.Join(tmpDir, history.QuarantineDir, o.runID, "sub", "copy.txt")
+				if _, err := os.Stat(stored); err != nil {
+					t.Errorf("duplicate not quarantined: %v", err)
+				}
+			case DupeTrash:
+				trashDir := filepath.Join(tmpDir, "data", "Trash")
+				if _, err := os.Stat(filepath.Join(trashDir, "files", "copy.txt")); err != nil {
+					t.Errorf("duplicate not trashed: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(trashDir, "info", "copy.txt.trashinfo")); err != nil {
+					t.Errorf("trash info missing: %v", err)
+				}
+			case DupeHardlink:
+				if same, _ := filecmp.SameFile(dup, kept); !same {
+					t.Error("duplicate should be a hardlink to the kept copy")
+				}
+			}
+			if action != DupeHardlink {
+				if _, err := os.Stat(dup); !os.IsNotExist(err) {
+					t.Error("duplicate should be gone from its folder")
+				}
+			}
+
+			if err := rollback.Undo(tmpDir, false); err != nil {
+				t.Fatalf("Undo failed: %v", err)
+			}
+			info, err := os.Stat(dup)
+			if err != nil {
+				t.Fatalf("duplicate not restored: %v", err)
+			}
+			if data, _ := os.ReadFile(dup); string(data) != "same text" {
+				t.Errorf("restored content = %q", data)
+			}
+			if keptInfo, _ := os.Stat(kept); os.SameFile(info, keptInfo) {
+				t.Error("undo should give the duplicate its own data again")
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("restored mode = %v, want 0600", info.Mode().Perm())
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, history.QuarantineDir)); !os.IsNotExist(err) {
+				t.Error("undo should remove the empty quarantine folder")
+			}
+		})
+	}
+}
+
+func TestFindDupes(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(rel, content string, age time.Duration) string {
+		path := filepath.Join(tmpDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+		return path
+	}
+	newer := write("photos/a/img.jpg", "pixels", time.Hour)
+	older := write("backup/deep/img.jpg", "pixels", 48*time.Hour)
+	write("photos/b/other.jpg", "PIXELS", time.Hour)
+	write("docs/empty1.txt", "", 0)
+	write("docs/empty2.txt", "", 0)
+	big1 := write("docs/big.bin", strings.Repeat("x", 100), time.Hour)
+	big2 := write("docs/big copy.bin", strings.Repeat("x", 100), time.Hour)
+	// another name of big1 takes no extra space
+	os.Link(big1, filepath.Join(tmpDir, "docs", "link.bin"))
+
+	o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+	groups, err := o.FindDupes(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatalf("FindDupes failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+	if groups[0].Size != 100 || len(groups[0].Files) != 2 || groups[0].Reclaimable() != 100 {
+		t.Errorf("largest group first, without the extra link: %+v", groups[0])
+	}
+
+	policies := map[string]string{"oldest": older, "newest": newer, "shortest": newer, "category:video": ""}
+	for spec, want := range policies {
+		policy, err := ParseKeepPolicy(spec)
+		if err != nil {
+			t.Fatalf("ParseKeepPolicy(%q) failed: %v", spec, err)
+		}
+		o.UseDefaultCategories()
+		o.ApplyKeepPolicy(groups, policy)
+		if groups[1].Keep != want {
+			t.Errorf("keep %s = %q, want %q", spec, groups[1].Keep, want)
+		}
+	}
+
+	policy, _ := ParseKeepPolicy("category:docs")
+	o.ApplyKeepPolicy(groups, policy)
+	if groups[0].Keep != big2 && groups[0].Keep != big1 {
+		t.Errorf("category policy should keep a file in docs, got %q", groups[0].Keep)
+	}
+
+	policy, _ = ParseKeepPolicy("oldest")
+	o.ApplyKeepPolicy(groups, policy)
+	o.SetDupeAction(DupeQuarantine)
+	if err := o.ResolveDupes(groups[1:]); err != nil {
+		t.Fatalf("ResolveDupes failed: %v", err)
+	}
+	if _, err := os.Stat(newer); !os.IsNotExist(err) {
+		t.Error("the newer copy should be quarantined")
+	}
+	if err := rollback.Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if _, err := os.Stat(newer); err != nil {
+		t.Errorf("undo should restore the quarantined copy: %v", err)
+	}
+}
+
+// testPicture draws a w x h gradient with a bright square; flip mirrors
+// it into a clearly different picture.
+func testPicture(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			if flip {
+				fx = 1 - fx
+			}
+			v := uint8(200 * fx)
+			if fx > 0.2 && fx < 0.4 && fy > 0.3 && fy < 0.5 {
+				v = 255
+			}
+			img.Set(x, y, color.RGBA{v, uint8(255 * fy), v, 255})
+		}
+	}
+	return img
+}
+
+func TestFindSimilar(t *testing.T) {
+	tmpDir := t.TempDir()
+	save := func(name string, img image.Image) string {
+		path := filepath.Join(tmpDir, name)
+		f, _ := os.Create(path)
+		defer f.Close()
+		if strings.HasSuffix(name, ".jpg") {
+			jpeg.Encode(f, img, &jpeg.Options{Quality: 70})
+		} else {
+			png.Encode(f, img)
+		}
+		return path
+	}
+	orig := save("photo.png", testPicture(400, 300, false))
+	small := save("photo_small.jpg", testPicture(100, 75, false))
+	data, _ := os.ReadFile(orig)
+	os.WriteFile(filepath.Join(tmpDir, "photo_copy.png"), data, 0644)
+	save("other.png", testPicture(400, 300, true))
+	os.WriteFile(filepath.Join(tmpDir, "broken.jpg"), []byte("not a jpeg"), 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+	exact, err := o.FindDupes(context.Background(), tmpDir)
+	if err != nil || len(exact) != 1 {
+		t.Fatalf("FindDupes = %+v, %v; want the one exact copy", exact, err)
+	}
+	similar, err := o.FindSimilar(context.Background(), phash.DHash, 10, exact)
+	if err != nil {
+		t.Fatalf("FindSimilar failed: %v", err)
+	}
+	if len(similar) != 1 {
+		t.Fatalf("expected 1 similar group, got %+v", similar)
+	}
+	g := similar[0]
+	if !g.Similar || len(g.Files) != 2 || g.Files[0] != orig || g.Files[1] != small {
+		t.Errorf("similar group = %+v; want %s and %s", g, orig, small)
+	}
+
+	policy, _ := ParseKeepPolicy("largest")
+	o.ApplyKeepPolicy(similar, policy)
+	if similar[0].Keep != orig {
+		t.Errorf("largest policy kept %q, want %q", similar[0].Keep, orig)
+	}
+	if want := similar[0].FileSize(small); similar[0].Reclaimable() != want {
+		t.Errorf("Reclaimable = %d, want %d", similar[0].Reclaimable(), want)
+	}
+
+	// Similar images are different files and must never be linked together
+	o.SetDupeAction(DupeHardlink)
+	if err := o.ResolveDupes(similar); err != nil {
+		t.Fatalf("ResolveDupes failed: %v", err)
+	}
+	if same, _ := filecmp.SameFile(orig, small); same {
+		t.Error("similar images must not be hardlinked")
+	}
+}
+
+func TestParseKeepPolicy_Invalid(t *testing.T) {
+	for _, spec := range []string{"biggest", "category:"} {
+		if _, err := ParseKeepPolicy(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestParseDupeAction(t *testing.T) {
+	for input, want := range map[string]DupeAction{
+		"":           DupeSkip,
+		"skip":       DupeSkip,
+		"Quarantine": DupeQuarantine,
+		"trash":      DupeTrash,
+		"hardlink":   DupeHardlink,
+	} {
+		if got, err := ParseDupeAction(input); err != nil || got != want {
+			t.Errorf("ParseDupeAction(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseDupeAction("delete"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+func TestDupIndex_HashesOnlySameSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+	a := write("a", "12345")
+	b := write("b", "1234567")
+	c := write("c", "12345")
+
+	o, _ := NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+	hashed := map[string]int{}
+	x := newDupIndex(o.hashEnds, func(path string) (string, error) {
+		hashed[filepath.Base(path)]++
+		return o.hashFile(path)
+	})
+
+	x.add(a, 5, dupSums{})
+	if twin, _, _ := x.find(b, 7); twin != "" || len(hashed) != 0 {
+		t.Errorf("a file of a new size must not be hashed: twin %q, hashed %v", twin, hashed)
+	}
+	x.add(b, 7, dupSums{})
+	twin, sums, err := x.find(c, 5)
+	if err != nil || twin != a || sums.full == "" {
+		t.Errorf("find(c) = %q, %+v, %v; want %q", twin, sums, err, a)
+	}
+	if hashed["b"] != 0 || hashed["a"] != 1 {
+		t.Errorf("unexpected hashing: %v", hashed)
+	}
+}
+
+func TestDupIndex_StagedHashing(t *testing.T) {
+	tmpDir := t.TempDir()
+	size := 3 * endBlock
+	write := func(name string, patch func([]byte)) string {
+		data := bytes.Repeat([]byte{'x'}, size)
+		patch(data)
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, data, 0644)
+		return path
+	}
+	orig := write("orig", func([]byte) {})
+	head := write("head", func(b []byte) { b[0] = 'h' })
+	middle := write("middle", func(b []byte) { b[size/2] = 'm' })
+	twin := write("twin", func([]byte) {})
+
+	o, _ := NewOrganizer(tmpDir, true, false, newTestLogger(), "", "", false)
+	full := map[string]int{}
+	x := newDupIndex(o.hashEnds, func(path string) (string, error) {
+		full[filepath.Base(path)]++
+		return o.hashFile(path)
+	})
+	x.same = filecmp.SameContent
+	x.add(orig, int64(size), dupSums{})
+
+	// A different first block is told apart without reading the rest
+	if got, _, _ := x.find(head, int64(size)); got != "" || len(full) != 0 {
+		t.Errorf("find(head) = %q with full hashes %v; want no match and no full hash", got, full)
+	}
+	// Matching ends need a full hash, which tells the middle apart
+	if got, _, _ := x.find(middle, int64(size)); got != "" || full["middle"] != 1 {
+		t.Errorf("find(middle) = %q with full hashes %v; want no match after a full hash", got, full)
+	}
+	if got, _, err := x.find(twin, int64(size)); got != orig || err != nil {
+		t.Errorf("find(twin) = %q, %v; want %q", got, err, orig)
+	}
+}
+
+func TestHashFile_UsesCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "movie.mkv")
+	os.WriteFile(path, []byte("frames"), 0644)
+
+	cache, _ := hashcache.Open(filepath.Join(tmpDir, hashcache.FileName))
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.SetHashCache(cache)
+
+	sum, err := o.hashFile(path)
+	if err != nil {
+		t.Fatalf("hashFile failed: %v", err)
+	}
+	info, _ := os.Stat(path)
+	if cached, ok := cache.Lookup(path, info, hashKindSHA256); !ok || cached != sum {
+		t.Fatalf("hash was not cached: %q, %v", cached, ok)
+	}
+
+	// A stale sum for the unchanged file proves the cache is read
+	cache.Store(path, info, hashKindSHA256, "cached")
+	if got, _ := o.hashFile(path); got != "cached" {
+		t.Errorf("hashFile = %q, want the cached sum", got)
 	}
 }
 
@@ -383,31 +2020,159 @@ func TestSaveHistory(t *testing.T) {
 	ctx := context.Background()
 
 	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.SetRunInfo("v1.2.3", []string{"--recursive=true"})
 	o.movedFiles = map[string]string{
 		filepath.Join(tmpDir, "docs", "file.txt"): filepath.Join(tmpDir, "file.txt"),
 	}
 	o.deletedDirs = []string{filepath.Join(tmpDir, "emptydir")}
 
-	// Run to trigger SaveHistory
+	// Run to trigger SaveHistory, twice: runs are appended, not replaced
+	o.Run(ctx)
+	firstID := o.runID
 	o.Run(ctx)
 
-	// Verify history file exists
-	statePath := filepath.Join(tmpDir, ".fileater-history.json")
-	if _, err := os.Stat(statePath); os.IsNotExist(err) {
-		t.Fatal("history file was not created")
+	runs, err := history.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to load history: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != firstID || runs[1].ID != o.runID || firstID == o.runID {
+		t.Fatalf("expected both runs in order, got %d", len(runs))
+	}
+
+	run := runs[0]
+	if run.Version != "v1.2.3" || run.Command != "organize" || len(run.Flags) != 1 {
+		t.Errorf("run metadata not recorded: %+v", run)
+	}
+	if run.Counts.Moved != 1 || run.Counts.DeletedDirs != 1 {
+		t.Errorf("unexpected counts: %+v", run.Counts)
+	}
+	if len(run.State.MovedFiles) != 1 {
+		t.Errorf("expected 1 moved file, got %d", len(run.State.MovedFiles))
+	}
+	if len(run.State.DeletedDirs) != 1 {
+		t.Errorf("expected 1 deleted dir, got %d", len(run.State.DeletedDirs))
+	}
+}
+
+func TestRun_Journal(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "report.pdf"), []byte("pdf"), 0644)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, history.JournalName)); !os.IsNotExist(err) {
+		t.Error("journal should be removed once the run is recorded")
+	}
+
+	// a journal left by a crash blocks the next run until it is recovered
+	os.WriteFile(filepath.Join(tmpDir, history.JournalName), []byte(`{"begin":{"id":"20260301-100000-abcd"}}`+"\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("txt"), 0644)
+	o, _ = NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	if err := o.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "recover") {
+		t.Fatalf("expected Run to refuse, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "notes.txt")); err != nil {
+		t.Error("nothing should be moved while a journal is left")
+	}
+}
+
+func TestRun_JournalKeptOnError(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	outside := filepath.Join(tmpDir, "outside", "Pictures")
+	os.MkdirAll(root, 0755)
+	// an unreadable ignore file fails the run after the folders are made
+	os.Mkdir(filepath.Join(root, ".fileaterignore"), 0755)
+
+	o, _ := NewOrganizer(root, false, false, newTestLogger(), "", "", false)
+	cfg := &config.Config{
+		Order:      []string{"images"},
+		Categories: map[string]config.Category{"images": {Ext: []string{".jpg"}, Dest: outside}},
+	}
+	if err := o.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(context.Background()); err == nil {
+		t.Fatal("expected Run to fail")
+	}
+
+	in, err := history.ReadJournal(root)
+	if err != nil || in == nil {
+		t.Fatalf("journal should be kept for recover: %v, %v", in, err)
+	}
+	if len(in.Run.State.CreatedDirs) == 0 {
+		t.Error("the directories created outside the root should be in the journal")
+	}
+}
+
+func TestRun_TemplateDuplicateLeavesNoDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{"images": {"ext": [".jpg"], "template": "images/{mtime:2006}"}}`
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy from 2021 duplicates a photo already organized under 2023
+	kept := filepath.Join(tmpDir, "images", "2023", "photo.jpg")
+	os.MkdirAll(filepath.Dir(kept), 0755)
+	os.WriteFile(kept, []byte("same photo"), 0644)
+	dup := filepath.Join(tmpDir, "copy.jpg")
+	os.WriteFile(dup, []byte("same photo"), 0644)
+	old := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.Local)
+	os.Chtimes(dup, old, old)
+
+	o, _ := NewOrganizer(tmpDir, false, false, newTestLogger(), "", "", false)
+	if err := o.LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
 	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if _, err := os.Stat(dup); err != nil {
+		t.Errorf("skipped duplicate should stay in place: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "images", "2021")); !os.IsNotExist(err) {
+		t.Error("no folder should be created for a skipped duplicate")
+	}
+}
+
+func TestRun_DupeActionIgnoresStaleHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	kept := filepath.Join(tmpDir, "docs", "original.txt")
+	other := filepath.Join(tmpDir, "sub", "rewritten.txt")
+	os.MkdirAll(filepath.Dir(kept), 0755)
+	os.MkdirAll(filepath.Dir(other), 0755)
+	os.WriteFile(kept, []byte("original text"), 0644)
+	os.WriteFile(other, []byte("replaced text"), 0644)
+
+	// the cache remembers the kept file's checksum for the rewritten one,
+	// as after a rewrite that kept its size and modification time
+	cache, err := hashcache.Open(filepath.Join(t.TempDir(), "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, _ := (&Organizer{}).hashFile(kept)
+	info, _ := os.Stat(other)
+	cache.Store(other, info, hashKindSHA256, sum)
 
-	// Verify content
-	data, _ := os.ReadFile(statePath)
-	var state history.HistoryState
-	if err := json.Unmarshal(data, &state); err != nil {
-		t.Fatalf("failed to parse history file: %v", err)
+	o, _ := NewOrganizer(tmpDir, false, true, newTestLogger(), "", "", false)
+	o.UseDefaultCategories()
+	o.SetHashCache(cache)
+	o.SetDupeAction(DupeQuarantine)
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
 	}
 
-	if len(state.MovedFiles) != 1 {
-		t.Errorf("expected 1 moved file, got %d", len(state.MovedFiles))
+	if len(o.duplicates) != 0 {
+		t.Errorf("a file with other content was set aside: %+v", o.duplicates)
 	}
-	if len(state.DeletedDirs) != 1 {
-		t.Errorf("expected 1 deleted dir, got %d", len(state.DeletedDirs))
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs", "rewritten.txt")); err != nil {
+		t.Errorf("the rewritten file should be organized: %v", err)
 	}
 }
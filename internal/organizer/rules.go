@@ -0,0 +1,145 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/riccione/fileater/internal/config"
+)
+
+// rule is the compiled form of config.Rule, ready for matching.
+type rule struct {
+	category  string
+	name      string
+	re        *regexp.Regexp
+	exts      map[string]struct{}
+	minSize   int64
+	maxSize   int64
+	olderThan AgeLimit
+	newerThan AgeLimit
+	parent    string
+}
+
+func compileRule(r config.Rule, binaryUnits bool) (rule, error) {
+	cr := rule{
+		category: r.Category,
+		name:     strings.ToLower(r.Name),
+		parent:   r.Parent,
+	}
+
+	if cr.name != "" {
+		if _, err := filepath.Match(cr.name, ""); err != nil {
+			return rule{}, fmt.Errorf("invalid name pattern %q: %w", r.Name, err)
+		}
+	}
+	if cr.parent != "" {
+		if _, err := filepath.Match(cr.parent, ""); err != nil {
+			return rule{}, fmt.Errorf("invalid parent pattern %q: %w", r.Parent, err)
+		}
+	}
+
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+		}
+		cr.re = re
+	}
+
+	if len(r.Ext) > 0 {
+		cr.exts = make(map[string]struct{}, len(r.Ext))
+		for _, ext := range r.Ext {
+			cr.exts[strings.ToLower(ext)] = struct{}{}
+		}
+	}
+
+	var err error
+	if cr.minSize, err = ParseSize(r.MinSize, binaryUnits); err != nil {
+		return rule{}, fmt.Errorf("invalid min_size: %w", err)
+	}
+	if cr.maxSize, err = ParseSize(r.MaxSize, binaryUnits); err != nil {
+		return rule{}, fmt.Errorf("invalid max_size: %w", err)
+	}
+	if cr.olderThan, err = ParseAgeLimit(r.OlderThan); err != nil {
+		return rule{}, fmt.Errorf("invalid older_than: %w", err)
+	}
+	if cr.newerThan, err = ParseAgeLimit(r.NewerThan); err != nil {
+		return rule{}, fmt.Errorf("invalid newer_than: %w", err)
+	}
+
+	return cr, nil
+}
+
+// needsInfo reports whether matching requires file metadata.
+func (r rule) needsInfo() bool {
+	return r.minSize > 0 || r.maxSize > 0 || !r.olderThan.IsZero() || !r.newerThan.IsZero()
+}
+
+// matches reports whether the file satisfies every condition of the rule.
+// exts are the file's extension candidates, longest first.
+// info may be nil, in which case rules that need metadata never match.
+func (r rule) matches(path, root string, exts []string, info fs.FileInfo, now time.Time) bool {
+	base := filepath.Base(path)
+	lowerBase := strings.ToLower(base)
+
+	if r.name != "" {
+		if ok, _ := filepath.Match(r.name, lowerBase); !ok {
+			return false
+		}
+	}
+
+	if r.re != nil && !r.re.MatchString(base) {
+		return false
+	}
+
+	if r.exts != nil {
+		found := false
+		for _, ext := range exts {
+			if _, ok := r.exts[ext]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.parent != "" {
+		parent := filepath.Dir(path)
+		rel, err := filepath.Rel(root, parent)
+		if err != nil {
+			rel = parent
+		}
+		nameOK, _ := filepath.Match(r.parent, filepath.Base(parent))
+		relOK, _ := filepath.Match(r.parent, filepath.ToSlash(rel))
+		if !nameOK && !relOK {
+			return false
+		}
+	}
+
+	if r.needsInfo() {
+		if info == nil {
+			return false
+		}
+		size := info.Size()
+		if r.minSize > 0 && size < r.minSize {
+			return false
+		}
+		if r.maxSize > 0 && size > r.maxSize {
+			return false
+		}
+		if !r.olderThan.IsZero() && !r.olderThan.Older(info.ModTime(), now) {
+			return false
+		}
+		if !r.newerThan.IsZero() && !r.newerThan.Newer(info.ModTime(), now) {
+			return false
+		}
+	}
+
+	return true
+}
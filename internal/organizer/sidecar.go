@@ -0,0 +1,253 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/riccione/fileater/internal/config"
+)
+
+// defaultSidecars are used unless the config lists its own groups.
+var defaultSidecars = []config.Sidecar{
+	{Ext: []string{".srt", ".ass", ".ssa", ".sub", ".vtt", ".idx"}},
+	{Ext: []string{".xmp"}},
+}
+
+// sidecarGroup is the compiled form of a config.Sidecar.
+type sidecarGroup struct {
+	exts []string
+	// primary extensions; empty means any file that is not a sidecar
+	primary map[string]struct{}
+}
+
+func compileSidecars(groups []config.Sidecar) []sidecarGroup {
+	compiled := make([]sidecarGroup, 0, len(groups))
+	for _, g := range groups {
+		sg := sidecarGroup{}
+		for _, ext := range g.Ext {
+			sg.exts = append(sg.exts, strings.ToLower(ext))
+		}
+		if len(g.Primary) > 0 {
+			sg.primary = make(map[string]struct{}, len(g.Primary))
+			for _, ext := range g.Primary {
+				sg.primary[strings.ToLower(ext)] = struct{}{}
+			}
+		}
+		compiled = append(compiled, sg)
+	}
+	return compiled
+}
+
+// hasExt reports whether name ends in one of the group's sidecar
+// extensions.
+func (g sidecarGroup) hasExt(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range g.exts {
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSidecar reports whether name has the extension of any sidecar group.
+func (o *Organizer) isSidecar(name string) bool {
+	for _, g := range o.sidecars {
+		if g.hasExt(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// belongsTo reports whether the file named sidecar follows the file at
+// primary under any group. The sidecar must start with the primary's stem
+// followed by a dot, which covers "movie.srt", "movie.en.srt" and
+// "DSC001.NEF.xmp".
+func (o *Organizer) belongsTo(sidecar, primary string) bool {
+	name := filepath.Base(primary)
+	if sidecar == name {
+		return false
+	}
+	stem, _ := o.splitExt(name)
+	if !strings.HasPrefix(sidecar, stem+".") {
+		return false
+	}
+
+	for _, g := range o.sidecars {
+		if !g.hasExt(sidecar) {
+			continue
+		}
+		if g.primary == nil {
+			if !o.isSidecar(name) {
+				return true
+			}
+			continue
+		}
+		for _, ext := range o.extCandidates(primary) {
+			if _, ok := g.primary[ext]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sidecarsOf returns the files next to primary that move along with it.
+func (o *Organizer) sidecarsOf(primary string) []string {
+	if len(o.sidecars) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(primary)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var members []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			continue
+		}
+		if _, done := o.claimed[path]; done {
+			continue
+		}
+		if o.isIgnored(path, false) {
+			continue
+		}
+		if o.belongsTo(entry.Name(), primary) {
+			members = append(members, path)
+		}
+	}
+	return members
+}
+
+// hasPrimary reports whether the sidecar at path has a primary file in
+// the same directory, which will move it when it is processed.
+func (o *Organizer) hasPrimary(path string) bool {
+	dir, name := filepath.Split(path)
+	if !o.isSidecar(name) {
+		return false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		primary := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() && !o.isIgnored(primary, false) && o.belongsTo(name, primary) {
+			return true
+		}
+	}
+	return false
+}
+
+// settleSidecars deals with the sidecars deferred during a walk that no
+// primary file took along. One whose primary stays where it is, because
+// it was filtered out or is a duplicate left in place, stays next to it;
+// one whose primary was set aside as a duplicate is organized on its own.
+// The walk has counted them as processed already.
+func (o *Organizer) settleSidecars(errorCount *int) {
+	deferred := o.deferred
+	o.deferred = nil
+	for _, path := range deferred {
+		if _, done := o.claimed[path]; done {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if o.hasPrimary(path) {
+			log.Printf("Skipped (primary file not moved): %s", path)
+			o.logger.Info("Sidecar left with its primary file",
+				"action", "SKIP_SIDECAR",
+				"path", path,
+			)
+			continue
+		}
+
+		if err := o.processFile(path, fs.FileInfoToDirEntry(info)); err != nil {
+			log.Printf("Error moving %s: %v", path, err)
+			o.logger.Error("Error moving file",
+				"source", path,
+				"error", err.Error(),
+			)
+			*errorCount++
+		}
+	}
+}
+
+// resolveGroupCollision is resolveCollision for a primary file and its
+// sidecars: it picks the first counter under which every member of the
+// group is free, so they keep sharing a base name.
+func (o *Organizer) resolveGroupCollision(dir, stem, ext string, suffixes []string) string {
+	free := func(s string) bool {
+		for _, suffix := range append([]string{ext}, suffixes...) {
+			if _, err := os.Stat(filepath.Join(dir, s+suffix)); !os.IsNotExist(err) {
+				return false
+			}
+		}
+		return true
+	}
+
+	candidate := stem
+	for counter := 1; !free(candidate); counter++ {
+		candidate = fmt.Sprintf("%s_%d", stem, counter)
+	}
+	return filepath.Join(dir, candidate+ext)
+}
+
+// sidecarSuffix is what follows the primary's stem in a sidecar name, such
+// as ".en.srt" for "movie.en.srt" next to "movie.mkv".
+func sidecarSuffix(fc *fileContext, sidecar string) string {
+	return strings.TrimPrefix(filepath.Base(sidecar), fc.stem)
+}
+
+// moveSidecars moves the sidecars of a primary file next to its final
+// path, renamed to share its new stem. A sidecar that fails to move is
+// left unclaimed, so it is organized on its own later, and the first
+// failure is returned.
+func (o *Organizer) moveSidecars(fc *fileContext, sidecars []string, primaryDest string) error {
+	var firstErr error
+	stem := strings.TrimSuffix(filepath.Base(primaryDest), fc.ext)
+	for _, src := range sidecars {
+		dest := filepath.Join(filepath.Dir(primaryDest), stem+sidecarSuffix(fc, src))
+
+		size, err := o.transfer(src, dest)
+		if err != nil {
+			o.logger.Error("Move failed",
+				"action", o.mode.action(),
+				"source", src,
+				"destination", dest,
+				"error", err.Error(),
+			)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sidecar %s: %s failed: %w", filepath.Base(src), o.mode, err)
+			}
+			continue
+		}
+		o.claimed[src] = struct{}{}
+		if o.dryRun {
+			continue
+		}
+		o.recordMove(dest, src)
+		o.dupes.add(dest, size, dupSums{})
+		o.totalBytes += size
+
+		log.Printf("%s: %s => %s (sidecar of %s)", o.mode.verb(), filepath.Base(src), filepath.Base(dest), filepath.Base(fc.path))
+		o.logger.Info("File moved",
+			"action", o.mode.action(),
+			"source", src,
+			"destination", dest,
+			"sidecar_of", fc.path,
+		)
+	}
+	return firstErr
+}
@@ -0,0 +1,129 @@
+package organizer
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/riccione/fileater/internal/phash"
+)
+
+// similarExts are the image formats perceptual hashing decodes.
+var similarExts = map[string]struct{}{".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {}}
+
+// FindSimilar groups the images in the sources scanned by FindDupes whose
+// perceptual hashes differ in at most maxDistance bits, largest
+// reclaimable space first. The copies of an exact duplicate group count
+// as one image, so similar groups never repeat what exact lists.
+func (o *Organizer) FindSimilar(ctx context.Context, algo phash.Algo, maxDistance int, exact []DupeGroup) ([]DupeGroup, error) {
+	copies := make(map[string]struct{})
+	for _, g := range exact {
+		for _, f := range g.Files[1:] {
+			copies[f] = struct{}{}
+		}
+	}
+
+	type image struct {
+		path string
+		size int64
+		hash uint64
+	}
+	var images []image
+	err := o.walkDupeCandidates(ctx, func(path string, info fs.FileInfo) {
+		if _, ok := similarExts[strings.ToLower(filepath.Ext(path))]; !ok {
+			return
+		}
+		if _, ok := copies[path]; ok {
+			return
+		}
+		h, err := o.perceptualHash(path, algo)
+		if err != nil {
+			log.Printf("Skipped (not a readable image): %s: %v", path, err)
+			return
+		}
+		images = append(images, image{path, info.Size(), h})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Link every pair within the distance; each set of linked images is
+	// a group
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if phash.Distance(images[i].hash, images[j].hash) <= maxDistance {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var order []int
+	for i := range images {
+		r := root(i)
+		if _, ok := members[r]; !ok {
+			order = append(order, r)
+		}
+		members[r] = append(members[r], i)
+	}
+
+	var groups []DupeGroup
+	for _, r := range order {
+		idx := members[r]
+		if len(idx) < 2 {
+			continue
+		}
+		g := DupeGroup{Similar: true}
+		for n, i := range idx {
+			g.Files = append(g.Files, images[i].path)
+			g.Sizes = append(g.Sizes, images[i].size)
+			g.Size = max(g.Size, images[i].size)
+			for _, j := range idx[n+1:] {
+				g.Distance = max(g.Distance, phash.Distance(images[i].hash, images[j].hash))
+			}
+		}
+		groups = append(groups, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Reclaimable() > groups[j].Reclaimable()
+	})
+	return groups, nil
+}
+
+// perceptualHash returns the perceptual hash of an image, from the hash
+// cache when the file is unchanged since it was last hashed.
+func (o *Organizer) perceptualHash(path string, algo phash.Algo) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	sum, err := o.cachedSum(file, path, "perceptual-"+algo.String(), func(f *os.File) (string, error) {
+		h, err := phash.Decode(f, algo)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(h, 16), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(sum, 16, 64)
+}
@@ -0,0 +1,105 @@
+package organizer
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// sizeRe splits a size into its number, which may have a fraction, and
+// its unit.
+var sizeRe = regexp.MustCompile(`^(\d+(?:\.\d*)?|\.\d+)\s*([a-zA-Z]+)$`)
+
+// iecUnits count in powers of 1024 regardless of the binary switch.
+var iecUnits = map[string]int64{
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// siPowers maps SI units and their one-letter forms to a power of the
+// unit base, 1000 or (for binary sizes) 1024.
+var siPowers = map[string]int{
+	"b":  0,
+	"kb": 1, "k": 1,
+	"mb": 2, "m": 2,
+	"gb": 3, "g": 3,
+	"tb": 4, "t": 4,
+	"pb": 5, "p": 5,
+}
+
+// ParseSize parses a size such as "100B", "1.5GB" or "512MiB" into bytes.
+// SI units (kB, MB, GB, TB, PB) are powers of 1000 and IEC units (KiB,
+// MiB, GiB, TiB, PiB) powers of 1024. With binary, SI units count in
+// powers of 1024 as well, as they did before IEC units were supported
+// (--binary-units). Units are case-insensitive and fractions are rounded
+// to the nearest byte.
+func ParseSize(sizeStr string, binary bool) (int64, error) {
+	sizeStr = strings.TrimSpace(sizeStr)
+	if sizeStr == "" {
+		return 0, nil
+	}
+
+	m := sizeRe.FindStringSubmatch(sizeStr)
+	if m == nil {
+		if strings.TrimLeft(sizeStr, "0123456789.") == sizeStr {
+			return 0, fmt.Errorf("invalid size format: %s", sizeStr)
+		}
+		return 0, fmt.Errorf("unknown size unit in: %s", sizeStr)
+	}
+	numStr, unit := m[1], strings.ToLower(m[2])
+
+	mult, ok := iecUnits[unit]
+	if !ok {
+		power, ok := siPowers[unit]
+		if !ok {
+			return 0, fmt.Errorf("unknown size unit %q in: %s", m[2], sizeStr)
+		}
+		base := int64(1000)
+		if binary {
+			base = 1024
+		}
+		mult = 1
+		for range power {
+			mult *= base
+		}
+	}
+
+	value, ok := new(big.Rat).SetString(numStr)
+	if !ok {
+		return 0, fmt.Errorf("invalid size value: %s", numStr)
+	}
+	value.Mul(value, new(big.Rat).SetInt64(mult))
+
+	// round half up to whole bytes
+	value.Add(value, big.NewRat(1, 2))
+	bytes := new(big.Int).Quo(value.Num(), value.Denom())
+	if !bytes.IsInt64() {
+		return 0, fmt.Errorf("size too large: %s", sizeStr)
+	}
+	return bytes.Int64(), nil
+}
+
+// FormatSize renders a byte count for humans, in SI units or, with
+// binary, in IEC units: "1.50 GB" or "1.40 GiB".
+func FormatSize(n int64, binary bool) string {
+	base, units := 1000.0, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+	if binary {
+		base, units = 1024.0, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	}
+
+	if n < int64(base) && n > -int64(base) {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	exp := 0
+	for math.Abs(value) >= base && exp < len(units)-1 {
+		value /= base
+		exp++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[exp])
+}
@@ -0,0 +1,68 @@
+package organizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/riccione/fileater/internal/sniff"
+)
+
+// SniffMode selects whether and when file content is used to categorize.
+type SniffMode int
+
+const (
+	// SniffOff categorizes by name only.
+	SniffOff SniffMode = iota
+	// SniffExtFirst trusts the extension and sniffs only files it can't place.
+	SniffExtFirst
+	// SniffContentFirst trusts the content and falls back to the extension.
+	SniffContentFirst
+)
+
+// ParseSniffMode parses the --sniff flag value.
+func ParseSniffMode(s string) (SniffMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off":
+		return SniffOff, nil
+	case "ext-first":
+		return SniffExtFirst, nil
+	case "content-first":
+		return SniffContentFirst, nil
+	}
+	return SniffOff, fmt.Errorf("unknown sniff mode %q (want off, ext-first or content-first)", s)
+}
+
+// SetSniffMode enables content sniffing for this run.
+func (o *Organizer) SetSniffMode(mode SniffMode) {
+	o.sniffMode = mode
+}
+
+// categorizeByContent detects the file type from its header and maps it to
+// a category, first via the config's MIME table and then via the canonical
+// extension of the detected type.
+func (o *Organizer) categorizeByContent(path string) (string, bool) {
+	t, ok, err := sniff.DetectFile(path)
+	if err != nil || !ok {
+		return "", false
+	}
+
+	category, found := o.mimeCategories[t.MIME]
+	if !found {
+		major, _, _ := strings.Cut(t.MIME, "/")
+		category, found = o.mimeCategories[major+"/*"]
+	}
+	if !found && t.Ext != "" {
+		category, found = o.categorizeByExt([]string{t.Ext})
+	}
+	if !found {
+		return "", false
+	}
+
+	o.logger.Info("Category from content",
+		"action", "SNIFF",
+		"path", path,
+		"mime", t.MIME,
+		"category", category,
+	)
+	return category, true
+}
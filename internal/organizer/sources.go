@@ -0,0 +1,80 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetSources makes the organizer scan the given directories instead of
+// its root, which then only receives the category folders (--dest).
+// Files keep moving with moveFile, so sources on another device work.
+func (o *Organizer) SetSources(paths ...string) {
+	o.sources = append([]string(nil), paths...)
+}
+
+// resolveSources makes the sources absolute, drops repeats and checks
+// that each is a directory. Without sources the root is scanned.
+func (o *Organizer) resolveSources() error {
+	paths := o.sources
+	if len(paths) == 0 {
+		paths = []string{o.rootPath}
+	}
+
+	seen := make(map[string]struct{}, len(paths))
+	o.sources = o.sources[:0]
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("failed to resolve source %s: %w", p, err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("invalid source: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("source %s is not a directory", abs)
+		}
+		if _, dup := seen[abs]; dup {
+			continue
+		}
+		seen[abs] = struct{}{}
+		o.sources = append(o.sources, abs)
+	}
+	return nil
+}
+
+// sourceRoot returns the source directory path was found in, preferring
+// the deepest one when sources are nested, or the root.
+func (o *Organizer) sourceRoot(path string) string {
+	best := ""
+	for _, src := range o.sources {
+		if isWithin(src, path) && len(src) > len(best) {
+			best = src
+		}
+	}
+	if best == "" {
+		return o.rootPath
+	}
+	return best
+}
+
+// recordMove remembers a transfer for the history, along with the source
+// directory the file came from and, unless it was a move, the mode.
+func (o *Organizer) recordMove(dest, src string) {
+	o.movedFiles[dest] = src
+	o.movedFrom[dest] = o.sourceRoot(src)
+	if o.mode != ModeMove {
+		o.modes[dest] = o.mode.String()
+	}
+}
+
+// isWithin reports whether path is dir or lies below it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,339 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/riccione/fileater/internal/audiotag"
+	"github.com/riccione/fileater/internal/exif"
+)
+
+// destTemplate is a parsed destination or rename template such as
+// "images/{mtime:2006}/{mtime:01}". Placeholders:
+//
+//	{category}      the category name
+//	{name}          the original file name without its extension
+//	{ext}           the lowercase extension without the dot ("noext" if none)
+//	{mtime:LAYOUT}  the modification time formatted with a Go time layout
+//	{size_bucket}   small (<1MB), medium (<100MB), large (<1GB) or huge
+//	{taken:LAYOUT}  the EXIF capture time, falling back to the mtime
+//	{make}          the EXIF camera make ("Unknown Make" if missing)
+//	{model}         the EXIF camera model ("Unknown Model" if missing)
+//	{camera}        make and model combined ("Unknown Camera" if missing)
+//	{artist}        the track artist, else album artist ("Unknown Artist")
+//	{album}         the album tag ("Unknown Album" if missing)
+//	{title}         the title tag, falling back to the original name
+//	{track:WIDTH}   the track number, zero-padded to WIDTH digits if given
+//	{year}          the release year tag ("Unknown Year" if missing)
+type destTemplate struct {
+	raw   string
+	parts []templatePart
+	// base is the fixed leading directory, which later runs must skip
+	base string
+}
+
+type templatePart struct {
+	literal string
+	field   string
+	arg     string
+}
+
+type argKind int
+
+const (
+	argNone argKind = iota
+	argRequired
+	argOptional
+)
+
+// templateFields lists the placeholders and whether they take an argument.
+var templateFields = map[string]argKind{
+	"category":    argNone,
+	"name":        argNone,
+	"ext":         argNone,
+	"size_bucket": argNone,
+	"mtime":       argRequired,
+	"taken":       argRequired,
+	"make":        argNone,
+	"model":       argNone,
+	"camera":      argNone,
+	"artist":      argNone,
+	"album":       argNone,
+	"title":       argNone,
+	"track":       argOptional,
+	"year":        argNone,
+}
+
+func parseTemplate(raw string) (*destTemplate, error) {
+	t := &destTemplate{raw: raw}
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("empty template")
+	}
+
+	rest := raw
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		closing := strings.IndexByte(rest, '}')
+		if open < 0 {
+			if closing >= 0 {
+				return nil, fmt.Errorf("template %q: unmatched '}'", raw)
+			}
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if closing >= 0 && closing < open {
+			return nil, fmt.Errorf("template %q: unmatched '}'", raw)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("template %q: unclosed '{'", raw)
+		}
+
+		field, arg, _ := strings.Cut(rest[open+1:open+end], ":")
+		kind, known := templateFields[field]
+		switch {
+		case !known:
+			return nil, fmt.Errorf("template %q: unknown placeholder {%s}", raw, field)
+		case kind == argRequired && arg == "":
+			return nil, fmt.Errorf("template %q: {%s} needs a layout, e.g. {%s:2006}", raw, field, field)
+		case kind == argNone && arg != "":
+			return nil, fmt.Errorf("template %q: {%s} takes no argument", raw, field)
+		}
+		if field == "track" && arg != "" {
+			if width, err := strconv.Atoi(arg); err != nil || width < 1 || width > 9 {
+				return nil, fmt.Errorf("template %q: {track:%s} needs a width from 1 to 9", raw, arg)
+			}
+		}
+		t.parts = append(t.parts, templatePart{field: field, arg: arg})
+		rest = rest[open+end+1:]
+	}
+
+	return t, nil
+}
+
+// parseDestTemplate parses a category destination, which is relative to
+// the root and must start with a fixed directory name.
+func parseDestTemplate(raw string) (*destTemplate, error) {
+	if filepath.IsAbs(raw) || strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("template %q must be relative to the root", raw)
+	}
+	t, err := parseTemplate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, elem := range strings.Split(filepath.ToSlash(raw), "/") {
+		if elem == ".." || elem == "." {
+			return nil, fmt.Errorf("template %q must not contain %q", raw, elem)
+		}
+	}
+
+	first, _, _ := strings.Cut(filepath.ToSlash(raw), "/")
+	if first == "" || strings.ContainsAny(first, "{}") {
+		return nil, fmt.Errorf("template %q must start with a fixed directory name", raw)
+	}
+	t.base = first
+
+	return t, nil
+}
+
+// parseNameTemplate parses a rename template, which yields a file name
+// without extension.
+func parseNameTemplate(raw string) (*destTemplate, error) {
+	t, err := parseTemplate(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range t.parts {
+		if strings.ContainsAny(p.literal, `/\`) {
+			return nil, fmt.Errorf("rename %q must not contain path separators", raw)
+		}
+		if p.field == "mtime" || p.field == "taken" {
+			if strings.ContainsAny(p.arg, `/\`) {
+				return nil, fmt.Errorf("rename %q must not contain path separators", raw)
+			}
+		}
+	}
+	return t, nil
+}
+
+// fileContext carries what templates can reference about one file.
+// Metadata that needs extra reads is loaded on first use.
+type fileContext struct {
+	path     string
+	category string
+	stem     string
+	ext      string
+	info     fs.FileInfo
+
+	exifLoaded bool
+	exif       *exif.Info
+
+	tagsLoaded bool
+	tags       *audiotag.Tags
+}
+
+func (o *Organizer) newFileContext(category, path string, info fs.FileInfo) *fileContext {
+	stem, ext := o.splitExt(filepath.Base(path))
+	return &fileContext{path: path, category: category, stem: stem, ext: ext, info: info}
+}
+
+// photo returns the file's EXIF data, or nil if it has none.
+func (fc *fileContext) photo() *exif.Info {
+	if !fc.exifLoaded {
+		fc.exifLoaded = true
+		if info, err := exif.ReadFile(fc.path); err == nil {
+			fc.exif = info
+		}
+	}
+	return fc.exif
+}
+
+// audio returns the file's audio tags, or nil if it has none.
+func (fc *fileContext) audio() *audiotag.Tags {
+	if !fc.tagsLoaded {
+		fc.tagsLoaded = true
+		if tags, err := audiotag.ReadFile(fc.path); err == nil {
+			fc.tags = tags
+		}
+	}
+	return fc.tags
+}
+
+// expand renders the template for one file.
+func (t *destTemplate) expand(fc *fileContext) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "category":
+			b.WriteString(fc.category)
+		case "name":
+			b.WriteString(sanitizeElem(fc.stem))
+		case "ext":
+			e := strings.ToLower(strings.TrimPrefix(fc.ext, "."))
+			if e == "" {
+				e = "noext"
+			}
+			b.WriteString(sanitizeElem(e))
+		case "mtime":
+			b.WriteString(formatDirs(fc.info.ModTime(), p.arg))
+		case "size_bucket":
+			b.WriteString(sizeBucket(fc.info.Size()))
+		case "taken":
+			taken := fc.info.ModTime()
+			if photo := fc.photo(); photo != nil && !photo.DateTimeOriginal.IsZero() {
+				taken = photo.DateTimeOriginal
+			}
+			b.WriteString(formatDirs(taken, p.arg))
+		case "make":
+			b.WriteString(exifField(fc, func(i *exif.Info) string { return i.Make }, "Unknown Make"))
+		case "model":
+			b.WriteString(exifField(fc, func(i *exif.Info) string { return i.Model }, "Unknown Model"))
+		case "camera":
+			b.WriteString(exifField(fc, cameraName, "Unknown Camera"))
+		case "artist":
+			b.WriteString(tagField(fc, func(t *audiotag.Tags) string {
+				if t.Artist != "" {
+					return t.Artist
+				}
+				return t.AlbumArtist
+			}, "Unknown Artist"))
+		case "album":
+			b.WriteString(tagField(fc, func(t *audiotag.Tags) string { return t.Album }, "Unknown Album"))
+		case "title":
+			b.WriteString(tagField(fc, func(t *audiotag.Tags) string { return t.Title }, sanitizeElem(fc.stem)))
+		case "year":
+			b.WriteString(tagField(fc, func(t *audiotag.Tags) string { return t.Year }, "Unknown Year"))
+		case "track":
+			track := 0
+			if tags := fc.audio(); tags != nil {
+				track = tags.Track
+			}
+			width, _ := strconv.Atoi(p.arg)
+			b.WriteString(fmt.Sprintf("%0*d", width, track))
+		}
+	}
+	return filepath.FromSlash(b.String())
+}
+
+func exifField(fc *fileContext, get func(*exif.Info) string, fallback string) string {
+	if photo := fc.photo(); photo != nil {
+		if v := strings.TrimSpace(get(photo)); v != "" {
+			return sanitizeElem(v)
+		}
+	}
+	return fallback
+}
+
+func tagField(fc *fileContext, get func(*audiotag.Tags) string, fallback string) string {
+	if tags := fc.audio(); tags != nil {
+		if v := sanitizeElem(strings.TrimSpace(get(tags))); v != "" && v != "_" {
+			return v
+		}
+	}
+	return fallback
+}
+
+// cameraName joins make and model, dropping the make when the model
+// already starts with it ("Canon" + "Canon EOS R6").
+func cameraName(i *exif.Info) string {
+	mk, model := strings.TrimSpace(i.Make), strings.TrimSpace(i.Model)
+	if mk == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(mk)) {
+		return model
+	}
+	if model == "" {
+		return mk
+	}
+	return mk + " " + model
+}
+
+func sizeBucket(size int64) string {
+	switch {
+	case size < 1<<20:
+		return "small"
+	case size < 100<<20:
+		return "medium"
+	case size < 1<<30:
+		return "large"
+	default:
+		return "huge"
+	}
+}
+
+// formatDirs formats t with a layout that may contain '/' to create
+// nested folders on purpose. Each folder name is sanitized, so a layout
+// such as "../2006" cannot climb out of the category folder.
+func formatDirs(t time.Time, layout string) string {
+	var elems []string
+	for _, elem := range strings.FieldsFunc(t.Format(layout), func(r rune) bool { return r == '/' || r == '\\' }) {
+		elems = append(elems, sanitizeElem(elem))
+	}
+	return strings.Join(elems, "/")
+}
+
+// sanitizeElem makes a value taken from a file name or its metadata safe
+// to use as one path element on any platform: separators, characters
+// Windows rejects and control characters become '_', and trailing dots
+// and spaces are dropped.
+func sanitizeElem(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.TrimRight(s, ". ")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,161 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/riccione/fileater/internal/history"
+)
+
+// TransferMode selects how files get into their category folder.
+type TransferMode int
+
+const (
+	// ModeMove moves files, the default.
+	ModeMove TransferMode = iota
+	// ModeCopy copies files and leaves the originals in place.
+	ModeCopy
+	// ModeHardlink links files into place; both names share the data, so
+	// source and destination must be on the same filesystem.
+	ModeHardlink
+	// ModeSymlink moves files and leaves a symlink at the old location.
+	ModeSymlink
+)
+
+// ParseTransferMode parses the --mode flag value.
+func ParseTransferMode(s string) (TransferMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "move":
+		return ModeMove, nil
+	case "copy":
+		return ModeCopy, nil
+	case "hardlink":
+		return ModeHardlink, nil
+	case "symlink":
+		return ModeSymlink, nil
+	}
+	return ModeMove, fmt.Errorf("unknown mode %q (want move, copy, hardlink or symlink)", s)
+}
+
+func (m TransferMode) String() string {
+	switch m {
+	case ModeCopy:
+		return "copy"
+	case ModeHardlink:
+		return "hardlink"
+	case ModeSymlink:
+		return "symlink"
+	}
+	return "move"
+}
+
+// action is the log action of a transfer, e.g. "COPY".
+func (m TransferMode) action() string {
+	return strings.ToUpper(m.String())
+}
+
+// verb is the past tense used in progress messages.
+func (m TransferMode) verb() string {
+	switch m {
+	case ModeCopy:
+		return "Copied"
+	case ModeHardlink:
+		return "Hardlinked"
+	case ModeSymlink:
+		return "Moved and linked"
+	}
+	return "Moved"
+}
+
+// keepsSource reports whether the original file stays where it is.
+func (m TransferMode) keepsSource() bool {
+	return m == ModeCopy || m == ModeHardlink
+}
+
+// SetTransferMode selects how files are transferred for this run.
+func (o *Organizer) SetTransferMode(mode TransferMode) {
+	o.mode = mode
+}
+
+// transfer puts src at dst according to the transfer mode, journaling
+// the change around it.
+func (o *Organizer) transfer(src, dst string) (int64, error) {
+	if o.dryRun {
+		log.Printf("[DRYRUN] Would %s %s to %s", o.mode, src, dst)
+		return 0, nil
+	}
+
+	seq, err := o.intend(history.Op{
+		Kind:       history.OpMove,
+		Src:        src,
+		Dst:        dst,
+		Mode:       o.mode.String(),
+		SourceRoot: o.sourceRoot(src),
+	})
+	if err != nil {
+		return 0, err
+	}
+	size, err := o.place(src, dst)
+	if err != nil {
+		o.fail(seq, err)
+		return 0, err
+	}
+	o.done(seq, nil)
+	return size, nil
+}
+
+// place puts src at dst according to the transfer mode.
+func (o *Organizer) place(src, dst string) (int64, error) {
+	switch o.mode {
+	case ModeCopy:
+		return copyFile(src, dst)
+	case ModeHardlink:
+		if err := os.Link(src, dst); err != nil {
+			return 0, fmt.Errorf("hardlink failed (source and destination must share a filesystem): %w", err)
+		}
+		fi, err := os.Stat(dst)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	case ModeSymlink:
+		size, err := o.moveFile(src, dst)
+		if err != nil {
+			return 0, err
+		}
+		if err := os.Symlink(dst, src); err != nil {
+			// put the file back rather than leave a dangling reference
+			if _, backErr := o.moveFile(dst, src); backErr != nil {
+				return 0, fmt.Errorf("symlink failed: %w (and restoring %s failed: %v)", err, src, backErr)
+			}
+			return 0, fmt.Errorf("symlink failed: %w", err)
+		}
+		return size, nil
+	}
+	return o.moveFile(src, dst)
+}
+
+// isOrganizedLink reports whether path is a symlink into a category
+// folder, such as one left behind by the symlink mode.
+func (o *Organizer) isOrganizedLink(path string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	for dir := range o.targetPaths {
+		if isWithin(dir, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+// Package phash computes 64-bit perceptual hashes of images, which stay
+// close when a picture is resized or re-encoded, unlike a checksum of its
+// bytes. Two images are alike when the Hamming distance between their
+// hashes is small.
+package phash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Algo selects how the hash is computed.
+type Algo int
+
+const (
+	// DHash compares neighbouring pixels of a 9x8 thumbnail, the default:
+	// fast and robust against brightness changes.
+	DHash Algo = iota
+	// AHash compares the pixels of an 8x8 thumbnail with their mean.
+	AHash
+	// PHash compares the low frequencies of a 32x32 thumbnail's DCT with
+	// their median; slowest, but the most robust against edits.
+	PHash
+)
+
+// ParseAlgo parses an algorithm name: dhash, ahash or phash.
+func ParseAlgo(s string) (Algo, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "dhash":
+		return DHash, nil
+	case "ahash":
+		return AHash, nil
+	case "phash":
+		return PHash, nil
+	}
+	return DHash, fmt.Errorf("unknown perceptual hash %q (want dhash, ahash or phash)", s)
+}
+
+func (a Algo) String() string {
+	switch a {
+	case AHash:
+		return "ahash"
+	case PHash:
+		return "phash"
+	}
+	return "dhash"
+}
+
+// Distance returns the number of bits in which two hashes differ, from 0
+// for near-identical images to 64.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// File decodes the JPEG, PNG or GIF image at path and hashes it.
+func File(path string, algo Algo) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h, err := Decode(f, algo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Decode reads a JPEG, PNG or GIF image and hashes it.
+func Decode(r io.Reader, algo Algo) (uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, err
+	}
+	return Hash(img, algo), nil
+}
+
+// Hash returns the perceptual hash of an image.
+func Hash(img image.Image, algo Algo) uint64 {
+	switch algo {
+	case AHash:
+		px := thumbnail(img, 8, 8)
+		var mean float64
+		for _, v := range px {
+			mean += v
+		}
+		mean /= float64(len(px))
+		return threshold(px, mean)
+	case PHash:
+		return dctHash(thumbnail(img, 32, 32))
+	}
+
+	px := thumbnail(img, 9, 8)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if px[y*9+x] < px[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// dctHash takes the 8x8 lowest frequencies of a 32x32 thumbnail's DCT
+// and sets a bit for each one above their median.
+func dctHash(px []float64) uint64 {
+	const n = 32
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / n * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	// separable DCT-II: rows, then the 8 lowest columns
+	rows := make([]float64, n*8)
+	for y := 0; y < n; y++ {
+		for k := 0; k < 8; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += px[y*n+x] * cos[k*n+x]
+			}
+			rows[y*8+k] = sum
+		}
+	}
+	low := make([]float64, 64)
+	for k := 0; k < 8; k++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*8+u] * cos[k*n+y]
+			}
+			low[k*8+u] = sum
+		}
+	}
+
+	// the DC term only carries the average brightness
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	return threshold(low, sorted[len(sorted)/2])
+}
+
+// threshold sets a bit, most significant first, for each value above t.
+func threshold(px []float64, t float64) uint64 {
+	var h uint64
+	for _, v := range px {
+		h <<= 1
+		if v > t {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// thumbnail scales an image down to w x h luminance values by averaging
+// the pixels that fall into each cell.
+func thumbnail(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	sums := make([]float64, w*h)
+	counts := make([]float64, w*h)
+	if b.Empty() {
+		return sums
+	}
+
+	luma := lumaFunc(img)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * w / b.Dx()
+			sums[cy*w+cx] += luma(x, y)
+			counts[cy*w+cx]++
+		}
+	}
+
+	// images smaller than the thumbnail leave cells empty; borrow from
+	// the pixel that covers them
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= counts[i]
+			continue
+		}
+		cx, cy := i%w, i/w
+		sums[i] = luma(b.Min.X+cx*b.Dx()/w, b.Min.Y+cy*b.Dy()/h)
+	}
+	return sums
+}
+
+// lumaFunc returns a reader of pixel luminance, reading the Y plane of
+// decoded JPEGs directly.
+func lumaFunc(img image.Image) func(x, y int) float64 {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) float64 { return float64(m.Y[m.YOffset(x, y)]) }
+	case *image.Gray:
+		return func(x, y int) float64 { return float64(m.Pix[m.PixOffset(x, y)]) }
+	}
+	return func(x, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+	}
+}
@@ -0,0 +1,83 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// scene draws a w x h picture of a bright disc on a gradient; flip mirrors
+// it to get a clearly different image.
+func scene(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			if flip {
+				fx = 1 - fx
+			}
+			v := uint8(200 * fx)
+			if dx, dy := fx-0.3, fy-0.4; dx*dx+dy*dy < 0.04 {
+				v = 255
+			}
+			img.Set(x, y, color.RGBA{v, uint8(255 * fy), v / 2, 255})
+		}
+	}
+	return img
+}
+
+func reencode(t *testing.T, img image.Image) image.Image {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestHash_ResizedAndReencoded(t *testing.T) {
+	orig := scene(640, 480, false)
+	small := reencode(t, scene(160, 120, false))
+	other := scene(640, 480, true)
+
+	for _, algo := range []Algo{DHash, AHash, PHash} {
+		t.Run(algo.String(), func(t *testing.T) {
+			h := Hash(orig, algo)
+			if d := Distance(h, Hash(small, algo)); d > 8 {
+				t.Errorf("resized JPEG copy at distance %d, want <= 8", d)
+			}
+			if d := Distance(h, Hash(other, algo)); d < 16 {
+				t.Errorf("different image at distance %d, want >= 16", d)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, scene(4, 3, false))
+	want := Hash(scene(4, 3, false), DHash)
+	if got, err := Decode(&buf, DHash); err != nil || got != want {
+		t.Errorf("Decode = %x, %v; want %x", got, err, want)
+	}
+	if _, err := Decode(bytes.NewReader([]byte("not an image")), DHash); err == nil {
+		t.Error("expected an error for data that is no image")
+	}
+}
+
+func TestParseAlgo(t *testing.T) {
+	for input, want := range map[string]Algo{"": DHash, "dHash": DHash, "ahash": AHash, "phash": PHash} {
+		if got, err := ParseAlgo(input); err != nil || got != want {
+			t.Errorf("ParseAlgo(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseAlgo("md5"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
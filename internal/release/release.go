@@ -0,0 +1,113 @@
+// Package release parses scene-style video release names such as
+// "Show.Name.S02E05.1080p.WEB.mkv" or "Title.2019.1080p.BluRay.x264.mkv".
+package release
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kind tells episodes and movies apart.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Episode
+	Movie
+)
+
+// Info is what a release name reveals.
+type Info struct {
+	Kind    Kind
+	Title   string
+	Year    int
+	Season  int
+	Episode int
+}
+
+var (
+	// S02E05, s2e5, S02.E05, S02 E05; the first episode of S01E01E02 wins
+	seasonEpisodeRe = regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,3})`)
+	// 2x05
+	crossEpisodeRe = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	yearRe         = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	// the rest of a date after its year: 2019-05-04, 2019.05.04
+	dateRestRe = regexp.MustCompile(`^[ -]\d{1,2}[ -]\d{1,2}\b`)
+	// quality and source tokens that mark a release
+	releaseTokenRe = regexp.MustCompile(`(?i)\b(\d{3,4}p|4k|uhd|hdr|web|web-?dl|web-?rip|blu-?ray|bdrip|brrip|dvdrip|hdtv|hdrip|remux|[xh]\.?26[45]|hevc|xvid)\b`)
+	spacesRe       = regexp.MustCompile(`\s+`)
+)
+
+// Parse extracts show or movie information from a file name without its
+// extension. Names that look like neither return Kind Unknown.
+func Parse(stem string) Info {
+	name := normalize(stem)
+
+	loc := seasonEpisodeRe.FindStringSubmatchIndex(name)
+	if loc == nil {
+		loc = crossEpisodeRe.FindStringSubmatchIndex(name)
+	}
+	if loc != nil {
+		title, year := splitYear(name[:loc[0]])
+		if title != "" {
+			season, _ := strconv.Atoi(name[loc[2]:loc[3]])
+			episode, _ := strconv.Atoi(name[loc[4]:loc[5]])
+			return Info{Kind: Episode, Title: title, Year: year, Season: season, Episode: episode}
+		}
+	}
+
+	// Movies need release markers besides the year, so dated clips such
+	// as "Birthday party 2019-05-04" are not taken for one
+	if !isSceneName(stem) && !releaseTokenRe.MatchString(stem) {
+		return Info{}
+	}
+
+	// the last year with a title in front of it, so that
+	// "Blade Runner 2049 2017" keeps 2049 in the title
+	years := yearRe.FindAllStringSubmatchIndex(name, -1)
+	for i := len(years) - 1; i >= 0; i-- {
+		title := cleanTitle(name[:years[i][0]])
+		if title == "" || dateRestRe.MatchString(name[years[i][1]:]) {
+			continue
+		}
+		year, _ := strconv.Atoi(name[years[i][2]:years[i][3]])
+		return Info{Kind: Movie, Title: title, Year: year}
+	}
+
+	return Info{}
+}
+
+// isSceneName reports whether stem is written the scene way, with dots or
+// underscores between its words instead of spaces.
+func isSceneName(stem string) bool {
+	return !strings.Contains(stem, " ") && strings.ContainsAny(stem, "._")
+}
+
+// normalize turns separators and brackets into spaces.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '_', '(', ')', '[', ']', '{', '}':
+			return ' '
+		}
+		return r
+	}, s)
+	return spacesRe.ReplaceAllString(s, " ")
+}
+
+// splitYear strips a trailing year from a show title: "Doctor Who 2005".
+func splitYear(s string) (string, int) {
+	title := cleanTitle(s)
+	if loc := yearRe.FindStringIndex(title); loc != nil && loc[1] == len(title) {
+		if rest := cleanTitle(title[:loc[0]]); rest != "" {
+			year, _ := strconv.Atoi(title[loc[0]:loc[1]])
+			return rest, year
+		}
+	}
+	return title, 0
+}
+
+func cleanTitle(s string) string {
+	return strings.Trim(strings.TrimSpace(s), " -")
+}
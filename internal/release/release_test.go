@@ -0,0 +1,37 @@
+package release
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		stem string
+		want Info
+	}{
+		{"Show.Name.S02E05.1080p.WEB", Info{Kind: Episode, Title: "Show Name", Season: 2, Episode: 5}},
+		{"show_name_s1e12_720p", Info{Kind: Episode, Title: "show name", Season: 1, Episode: 12}},
+		{"The.Office.US.S05E14E15.HDTV", Info{Kind: Episode, Title: "The Office US", Season: 5, Episode: 14}},
+		{"Doctor.Who.2005.S13E01.HDTV", Info{Kind: Episode, Title: "Doctor Who", Year: 2005, Season: 13, Episode: 1}},
+		{"Firefly - 1x03 - Bushwhacked", Info{Kind: Episode, Title: "Firefly", Season: 1, Episode: 3}},
+		{"Title.2019.1080p.BluRay.x264", Info{Kind: Movie, Title: "Title", Year: 2019}},
+		{"Blade.Runner.2049.2017.2160p.UHD", Info{Kind: Movie, Title: "Blade Runner 2049", Year: 2017}},
+		{"The Matrix (1999) [1080p]", Info{Kind: Movie, Title: "The Matrix", Year: 1999}},
+		{"2001.A.Space.Odyssey.1968.REMASTERED", Info{Kind: Movie, Title: "2001 A Space Odyssey", Year: 1968}},
+		{"Title 2019 WEB-DL", Info{Kind: Movie, Title: "Title", Year: 2019}},
+		{"holiday_video", Info{}},
+		{"Birthday party 2019-05-04", Info{}},
+		{"Birthday party 2019-05-04 with grandma", Info{}},
+		{"birthday_party_2019-05-04", Info{}},
+		{"Trip.2021.07.14", Info{}},
+		{"Summer holiday 2019", Info{}},
+		{"2019", Info{}},
+		{"S01E01", Info{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stem, func(t *testing.T) {
+			if got := Parse(tt.stem); got != tt.want {
+				t.Errorf("Parse(%q) = %+v; want %+v", tt.stem, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package rollback
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/riccione/fileater/internal/filecmp"
+	"github.com/riccione/fileater/internal/history"
+)
+
+// Recover deals with a run cut short by a crash, using the journal it left
+// in rootPath. The operation in flight is checked on disk and either
+// counted as done or cleaned up, then the run is recorded in the history
+// log. With undo, the run is rolled back as well.
+func Recover(rootPath string, undo, dryRun bool) error {
+	in, err := history.ReadJournal(rootPath)
+	if err != nil {
+		return err
+	}
+	if in == nil {
+		return fmt.Errorf("no interrupted run found in %s", rootPath)
+	}
+	if undo {
+		return UndoRun(rootPath, in.Run.ID, dryRun, false)
+	}
+	run, err := settle(rootPath, in, dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		log.Printf("[DRY RUN] Would record run %s: %d file(s) moved, %d duplicate(s), %d dir(s) removed",
+			run.ID, run.Counts.Moved, run.Counts.Duplicates, run.Counts.DeletedDirs)
+		return nil
+	}
+	log.Printf("Recovered run %s: %d file(s) moved, %d duplicate(s), %d dir(s) removed; organize again to finish the rest",
+		run.ID, run.Counts.Moved, run.Counts.Duplicates, run.Counts.DeletedDirs)
+	return nil
+}
+
+// settle resolves the operations an interrupted run started but never
+// marked complete, appends the run to the history log unless it changed
+// nothing, and removes the journal. A dry run only reports what it would
+// do.
+func settle(rootPath string, in *history.Interrupted, dryRun bool) (*history.Run, error) {
+	for _, op := range in.Pending() {
+		settleOp(op, dryRun)
+	}
+
+	run := in.Run
+	run.State = in.State()
+	run.Counts.Moved = len(run.State.MovedFiles)
+	run.Counts.Duplicates = len(run.State.Duplicates)
+	run.Counts.DeletedDirs = len(run.State.DeletedDirs)
+	if dryRun {
+		return run, nil
+	}
+
+	run.Interrupted = false
+	if len(run.Touched()) > 0 || len(run.State.DeletedDirs) > 0 || len(run.State.CreatedDirs) > 0 {
+		if err := history.Append(rootPath, run); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Remove(filepath.Join(rootPath, history.JournalName)); err != nil {
+		return nil, fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return run, nil
+}
+
+// settleOp checks how far an unfinished operation got. One that completed
+// is marked done; a partial copy is removed, since its source is still
+// there. A copy is complete when its content matches the source's.
+func settleOp(op *history.Op, dryRun bool) {
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+	remove := func(path, what string) {
+		if dryRun {
+			log.Printf("[DRY RUN] Would remove %s %s", what, path)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("failed to remove %s %s: %v", what, path, err)
+		} else {
+			log.Printf("removed %s: %s", what, path)
+		}
+	}
+
+	switch op.Kind {
+	case history.OpMove:
+		src, dst := op.Src, op.Dst
+		switch {
+		case !exists(dst):
+			if !exists(src) {
+				log.Printf("warning: %s is missing and never reached %s", src, dst)
+			}
+			// not started
+		case op.Mode == "hardlink":
+			if same, _ := filecmp.SameFile(src, dst); same || !exists(src) {
+				op.Done = true
+			}
+		case op.Mode == "symlink" && isSymlink(src):
+			op.Done = true
+		case op.Mode == "copy" && exists(src):
+			// a copy always leaves the source; keep it if it is complete
+			if same, _ := filecmp.SameContent(src, dst); !same {
+				remove(dst, "partial copy")
+				break
+			}
+			if !dryRun {
+				copyMetadata(src, dst)
+			}
+			op.Done = true
+		case exists(src):
+			// copied at most partly, or completely but the source is still
+			// there; the source is intact either way
+			remove(dst, "partial copy")
+		case op.Mode == "symlink":
+			// moved, but the link was not made yet
+			if dryRun {
+				log.Printf("[DRY RUN] Would link %s to %s", src, dst)
+			} else if err := os.Symlink(dst, src); err != nil {
+				log.Printf("failed to link %s to %s: %v", src, dst, err)
+			}
+			op.Done = true
+		default:
+			op.Done = true
+		}
+
+	case history.OpMkdir:
+		op.Done = exists(op.Path)
+
+	case history.OpRmdir:
+		op.Done = !exists(op.Path)
+
+	case history.OpDuplicate:
+		dup := op.Dup
+		if dup == nil {
+			return
+		}
+		switch dup.Action {
+		case "quarantine":
+			switch {
+			case !exists(dup.Stored):
+			case exists(dup.Path):
+				remove(dup.Stored, "partial copy")
+			default:
+				op.Done = true
+			}
+		case "trash":
+			if !exists(dup.Path) {
+				log.Printf("warning: duplicate %s was moved to the trash; restore it from there if needed", dup.Path)
+			}
+		case "hardlink":
+			if same, _ := filecmp.SameFile(dup.Path, dup.KeptCopy); same {
+				op.Done = true
+			}
+			tmp := filepath.Join(filepath.Dir(dup.Path), history.LinkTempPrefix+filepath.Base(dup.Path))
+			if exists(tmp) {
+				remove(tmp, "temporary link")
+			}
+		}
+	}
+}
+
+// copyMetadata gives dst the permissions and modification time of src,
+// which a copy cut short may not have set yet.
+func copyMetadata(src, dst string) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return
+	}
+	if err := os.Chmod(dst, info.Mode()); err != nil {
+		log.Printf("failed to set permissions of %s: %v", dst, err)
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		log.Printf("failed to set timestamps of %s: %v", dst, err)
+	}
+}
+
+func isSymlink(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
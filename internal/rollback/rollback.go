@@ -1,40 +1,84 @@
 package rollback
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/riccione/fileater/internal/history"
+	"github.com/riccione/fileater/internal/trash"
 )
 
+// Undo reverses the latest run recorded for rootPath that was not undone
+// yet.
 func Undo(rootPath string, dryRun bool) error {
-	statePath := filepath.Join(rootPath, ".fileater-history.json")
-	if _, err := os.Stat(statePath); os.IsNotExist(err) {
-		return fmt.Errorf("history file not found: %s", statePath)
-	}
+	return UndoRun(rootPath, "", dryRun, false)
+}
 
-	data, err := os.ReadFile(statePath)
+// UndoRun reverses the run with the given ID (or a unique prefix of it),
+// or the latest run not undone yet when id is empty. It refuses when a
+// later run that was not undone touched the same files, since undoing out
+// of order could move the wrong files; with force it only warns. A run
+// that was interrupted is read from its journal and recorded first.
+func UndoRun(rootPath, id string, dryRun, force bool) error {
+	runs, err := history.Load(rootPath)
 	if err != nil {
-		return fmt.Errorf("failed to read history file: %w", err)
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("history file not found: %s", filepath.Join(rootPath, history.StoreName))
+	}
+	run, err := history.Find(runs, id)
+	if err != nil {
+		return err
+	}
+	if !run.UndoneAt.IsZero() {
+		return fmt.Errorf("run %s was already undone at %s", run.ID, run.UndoneAt.Format(time.RFC3339))
 	}
 
-	var state history.HistoryState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return fmt.Errorf("failed to parse history file: %w", err)
+	if later, shared := history.Later(runs, run); len(later) > 0 {
+		ids := make([]string, len(later))
+		for i, r := range later {
+			ids[i] = r.ID
+		}
+		msg := fmt.Sprintf("later run(s) %s touched %d of the same path(s), e.g. %s", strings.Join(ids, ", "), len(shared), shared[0])
+		if !force {
+			return fmt.Errorf("%s; undo them first or pass --force", msg)
+		}
+		log.Printf("warning: %s", msg)
+	}
+
+	if run.Interrupted {
+		// settle the operation the crash cut short before reversing the rest
+		in, err := history.ReadJournal(rootPath)
+		if err != nil {
+			return err
+		}
+		if run, err = settle(rootPath, in, dryRun); err != nil {
+			return err
+		}
 	}
 
+	log.Printf("Undoing run %s", run.ID)
+	state := run.State
+
 	var failures []string
 
 	if dryRun {
 		log.Println("[DRY RUN] Showing what would be restored:")
 	}
 
+	// Files gathered with --dest came from source directories outside
+	// the root; their directories may be recreated as well
+	allowed := append([]string{rootPath}, state.SourceRoots...)
+
 	for _, dir := range state.DeletedDirs {
-		if !isSubPath(rootPath, dir) {
+		if !isUnderAny(allowed, dir) {
 			log.Printf("skipping directory outside root: %s", dir)
 			continue
 		}
@@ -61,6 +105,36 @@ func Undo(rootPath string, dryRun bool) error {
 			continue
 		}
 
+		switch mode := state.Modes[currentPath]; mode {
+		case "copy", "hardlink":
+			// The original stayed in place, so only the copy or link goes;
+			// if the original is gone since, the file is moved back instead
+			if _, err := os.Lstat(originalPath); err == nil {
+				if dryRun {
+					log.Printf("[DRY RUN] Would remove %s %s of %s", mode, currentPath, originalPath)
+				} else if err := os.Remove(currentPath); err != nil {
+					msg := fmt.Sprintf("failed to remove %s %s: %v", mode, currentPath, err)
+					log.Println(msg)
+					failures = append(failures, msg)
+				} else {
+					log.Printf("removed %s: %s", mode, currentPath)
+				}
+				continue
+			}
+		case "symlink":
+			// Replace the link left at the original location by the file
+			if fi, err := os.Lstat(originalPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				if dryRun {
+					log.Printf("[DRY RUN] Would remove symlink %s", originalPath)
+				} else if err := os.Remove(originalPath); err != nil {
+					msg := fmt.Sprintf("failed to remove symlink %s: %v", originalPath, err)
+					log.Println(msg)
+					failures = append(failures, msg)
+					continue
+				}
+			}
+		}
+
 		originalDir := filepath.Dir(originalPath)
 		if dryRun {
 			log.Printf("[DRY RUN] Would move %s back to %s", currentPath, originalPath)
@@ -73,7 +147,7 @@ func Undo(rootPath string, dryRun bool) error {
 				continue
 			}
 
-			if err := os.Rename(currentPath, originalPath); err != nil {
+			if err := moveBack(currentPath, originalPath); err != nil {
 				msg := fmt.Sprintf("failed to move %s back to %s: %v", currentPath, originalPath, err)
 				log.Println(msg)
 				failures = append(failures, msg)
@@ -83,23 +157,216 @@ func Undo(rootPath string, dryRun bool) error {
 		}
 	}
 
+	failures = append(failures, restoreDuplicates(&state, allowed, dryRun)...)
+
+	removeCreatedDirs(state.CreatedDirs, dryRun)
+
 	if !dryRun {
-		if err := os.Remove(statePath); err != nil {
-			log.Printf("warning: failed to delete history file: %v", err)
-		} else {
-			log.Printf("deleted history file: %s", statePath)
+		if run.Legacy {
+			statePath := filepath.Join(rootPath, history.FileName)
+			if err := os.Remove(statePath); err != nil {
+				log.Printf("warning: failed to delete history file: %v", err)
+			} else {
+				log.Printf("deleted history file: %s", statePath)
+			}
+		} else if err := history.MarkUndone(rootPath, run.ID, time.Now()); err != nil {
+			log.Printf("warning: failed to record the undo: %v", err)
 		}
 
 		if len(failures) > 0 {
 			return fmt.Errorf("undo completed with %d failure(s): %v", len(failures), failures)
 		}
 	} else {
-		log.Printf("[DRY RUN] Would delete history file: %s", statePath)
+		log.Printf("[DRY RUN] Would mark run %s as undone", run.ID)
 	}
 
 	return nil
 }
 
+// restoreDuplicates reverses what a run did with duplicates: quarantined
+// and trashed files are moved back, and hardlinks get their own copy of
+// the data again. It returns the failures.
+func restoreDuplicates(state *history.HistoryState, allowed []string, dryRun bool) []string {
+	var failures []string
+	fail := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		log.Println(msg)
+		failures = append(failures, msg)
+	}
+
+	for _, dup := range state.Duplicates {
+		if !isUnderAny(allowed, dup.Path) {
+			log.Printf("skipping duplicate outside root: %s", dup.Path)
+			continue
+		}
+		if dryRun {
+			log.Printf("[DRY RUN] Would restore %s duplicate %s", dup.Action, dup.Path)
+			continue
+		}
+
+		switch dup.Action {
+		case "quarantine", "trash":
+			if _, err := os.Lstat(dup.Path); err == nil {
+				fail("cannot restore duplicate, %s exists again", dup.Path)
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(dup.Path), 0755); err != nil {
+				fail("failed to create parent directory for %s: %v", dup.Path, err)
+				continue
+			}
+			var err error
+			if dup.Action == "trash" {
+				err = trash.Restore(trash.Item{File: dup.Stored, Info: dup.TrashInfo}, dup.Path)
+			} else {
+				err = moveBack(dup.Stored, dup.Path)
+			}
+			if err != nil {
+				fail("failed to restore duplicate %s from %s: %v", dup.Path, dup.Stored, err)
+				continue
+			}
+			if dup.Action == "quarantine" {
+				removeEmptyParents(filepath.Dir(dup.Stored), filepath.Join(state.RootPath, history.QuarantineDir))
+			}
+			log.Printf("restored duplicate: %s", dup.Path)
+		case "hardlink":
+			if err := unlinkCopy(dup.Path, dup.Mode, dup.ModTime); err != nil {
+				fail("failed to separate %s from %s: %v", dup.Path, dup.KeptCopy, err)
+				continue
+			}
+			log.Printf("separated duplicate from kept copy: %s", dup.Path)
+		default:
+			fail("unknown duplicate action %q for %s", dup.Action, dup.Path)
+		}
+	}
+	return failures
+}
+
+// unlinkCopy replaces a hardlink by a file of its own with the same
+// content, mode and modification time.
+func unlinkCopy(path string, mode os.FileMode, modTime time.Time) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := filepath.Join(filepath.Dir(path), ".fileater-unlink-"+filepath.Base(path))
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, mode.Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents up to and including stop
+// as long as they are empty.
+func removeEmptyParents(dir, stop string) {
+	for isSubPath(stop, dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		if dir == filepath.Clean(stop) {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// removeCreatedDirs removes the directories a run created outside the
+// root for categories with their own destination, deepest first, as long
+// as they are empty again.
+func removeCreatedDirs(dirs []string, dryRun bool) {
+	dirs = append([]string(nil), dirs...)
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if dryRun {
+			log.Printf("[DRY RUN] Would remove created directory: %s", dir)
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			log.Printf("warning: failed to remove created directory %s: %v", dir, err)
+		} else {
+			log.Printf("removed created directory: %s", dir)
+		}
+	}
+}
+
+// moveBack renames a file to its original path, copying it when the
+// original lies on another device.
+func moveBack(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// isUnderAny reports whether target lies within one of the roots.
+func isUnderAny(roots []string, target string) bool {
+	for _, root := range roots {
+		if isSubPath(root, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // isSubPath checks if target path is within root path, ensuring proper path boundary
 func isSubPath(root, target string) bool {
 	root = filepath.Clean(root)
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/riccione/fileater/internal/history"
 )
@@ -168,3 +170,162 @@ func TestUndo_DryRun(t *testing.T) {
 		t.Error("history file should NOT be deleted in dry-run mode")
 	}
 }
+
+func TestUndoRun_ByIDAndConflicts(t *testing.T) {
+	tmpDir := t.TempDir()
+	orig := filepath.Join(tmpDir, "a.txt")
+	first := filepath.Join(tmpDir, "docs", "a.txt")
+	second := filepath.Join(tmpDir, "archive", "a.txt")
+	os.MkdirAll(filepath.Dir(second), 0755)
+	os.WriteFile(second, []byte("content"), 0644)
+
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	runA := &history.Run{ID: history.NewRunID(t0), State: history.HistoryState{
+		MovedFiles: map[string]string{first: orig}, RootPath: tmpDir,
+	}}
+	runB := &history.Run{ID: history.NewRunID(t0.Add(time.Minute)), State: history.HistoryState{
+		MovedFiles: map[string]string{second: first}, RootPath: tmpDir,
+	}}
+	history.Append(tmpDir, runA)
+	history.Append(tmpDir, runB)
+
+	// the second run moved the file on; undoing the first alone is refused
+	if err := UndoRun(tmpDir, runA.ID, false, false); err == nil || !strings.Contains(err.Error(), runB.ID) {
+		t.Fatalf("expected a conflict with %s, got %v", runB.ID, err)
+	}
+
+	// undoing in order restores the file
+	if err := UndoRun(tmpDir, runB.ID, false, false); err != nil {
+		t.Fatalf("undo of the later run failed: %v", err)
+	}
+	if err := UndoRun(tmpDir, "", false, false); err != nil {
+		t.Fatalf("undo of the earlier run failed: %v", err)
+	}
+	if _, err := os.Stat(orig); err != nil {
+		t.Errorf("file not restored: %v", err)
+	}
+
+	if err := UndoRun(tmpDir, runA.ID, false, false); err == nil {
+		t.Error("expected undoing a run twice to fail")
+	}
+	if err := Undo(tmpDir, false); err == nil {
+		t.Error("expected an error with no run left to undo")
+	}
+}
+
+// interruptedRun leaves the journal of a run that moved a.txt, was moving
+// b.txt by copying when it crashed, and never got to c.txt.
+func interruptedRun(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	docs := filepath.Join(dir, "docs")
+	os.MkdirAll(docs, 0755)
+	for _, name := range []string{"b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	os.WriteFile(filepath.Join(docs, "a.txt"), []byte("a.txt"), 0644)
+	os.WriteFile(filepath.Join(docs, "b.txt"), []byte("b."), 0644) // partial
+
+	id := history.NewRunID(time.Now())
+	j, err := history.BeginJournal(dir, &history.Run{ID: id, State: history.HistoryState{RootPath: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, _ := j.Intend(history.Op{Kind: history.OpMove, Src: filepath.Join(dir, "a.txt"), Dst: filepath.Join(docs, "a.txt"), Mode: "move"})
+	j.Done(seq, nil)
+	j.Intend(history.Op{Kind: history.OpMove, Src: filepath.Join(dir, "b.txt"), Dst: filepath.Join(docs, "b.txt"), Mode: "move"})
+	j.Close()
+	return id, docs
+}
+
+func TestRecover_Finish(t *testing.T) {
+	tmpDir := t.TempDir()
+	id, docs := interruptedRun(t, tmpDir)
+
+	if err := Recover(tmpDir, false, false); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(docs, "b.txt")); !os.IsNotExist(err) {
+		t.Error("partial copy should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, history.JournalName)); !os.IsNotExist(err) {
+		t.Error("journal should be removed")
+	}
+
+	runs, err := history.Load(tmpDir)
+	if err != nil || len(runs) != 1 || runs[0].ID != id || len(runs[0].State.MovedFiles) != 1 {
+		t.Fatalf("recovered run not recorded: %v, %v", runs, err)
+	}
+
+	// the recorded run undoes like any other
+	if err := Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "a.txt")); err != nil {
+		t.Error("a.txt was not moved back")
+	}
+}
+
+func TestUndo_InterruptedRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, docs := interruptedRun(t, tmpDir)
+
+	// undo reads the journal directly, without recover first
+	if err := Undo(tmpDir, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil || string(data) != name {
+			t.Errorf("%s not intact: %q, %v", name, data, err)
+		}
+	}
+	if entries, _ := os.ReadDir(docs); len(entries) != 0 {
+		t.Errorf("docs should be empty, has %d entries", len(entries))
+	}
+
+	runs, _ := history.Load(tmpDir)
+	if len(runs) != 1 || runs[0].UndoneAt.IsZero() {
+		t.Error("interrupted run should be recorded as undone")
+	}
+}
+
+func TestRecover_InterruptedCopy(t *testing.T) {
+	tmpDir := t.TempDir()
+	docs := filepath.Join(tmpDir, "docs")
+	os.MkdirAll(docs, 0755)
+	done := filepath.Join(tmpDir, "done.txt")
+	partial := filepath.Join(tmpDir, "partial.txt")
+	os.WriteFile(done, []byte("complete copy"), 0640)
+	os.WriteFile(partial, []byte("partial copy"), 0644)
+	// the crash came after the first copy was written but before it was
+	// marked done, and halfway through the second
+	os.WriteFile(filepath.Join(docs, "done.txt"), []byte("complete copy"), 0644)
+	os.WriteFile(filepath.Join(docs, "partial.txt"), []byte("part"), 0644)
+
+	j, err := history.BeginJournal(tmpDir, &history.Run{ID: history.NewRunID(time.Now()), State: history.HistoryState{RootPath: tmpDir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Intend(history.Op{Kind: history.OpMove, Src: done, Dst: filepath.Join(docs, "done.txt"), Mode: "copy"})
+	j.Intend(history.Op{Kind: history.OpMove, Src: partial, Dst: filepath.Join(docs, "partial.txt"), Mode: "copy"})
+	j.Close()
+
+	if err := Recover(tmpDir, false, false); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(docs, "done.txt"))
+	if err != nil {
+		t.Fatalf("the complete copy should be kept: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("copy should get the source's permissions, has %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(docs, "partial.txt")); !os.IsNotExist(err) {
+		t.Error("the partial copy should be removed")
+	}
+
+	runs, _ := history.Load(tmpDir)
+	if len(runs) != 1 || len(runs[0].State.MovedFiles) != 1 || runs[0].State.Modes[filepath.Join(docs, "done.txt")] != "copy" {
+		t.Fatalf("the complete copy should be recorded: %+v", runs)
+	}
+}
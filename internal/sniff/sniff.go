@@ -0,0 +1,162 @@
+// Package sniff detects file types from their leading bytes.
+package sniff
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// headerSize is how much of a file is read for detection. It is large
+// enough to see the first few ZIP entry names of an OOXML document.
+const headerSize = 4096
+
+// Type describes a detected file type.
+type Type struct {
+	MIME string
+	// Ext is the canonical extension for the type, with a leading dot.
+	Ext string
+}
+
+// DetectFile reads the header of the file at path and detects its type.
+// It returns ok=false when the content is not recognized.
+func DetectFile(path string) (Type, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Type{}, false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, headerSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Type{}, false, err
+	}
+
+	t, ok := Detect(buf[:n])
+	return t, ok, nil
+}
+
+// Detect identifies the type of the given file header.
+func Detect(header []byte) (Type, bool) {
+	h := header
+	switch {
+	case bytes.HasPrefix(h, []byte("\x89PNG\r\n\x1a\n")):
+		return Type{"image/png", ".png"}, true
+	case bytes.HasPrefix(h, []byte{0xFF, 0xD8, 0xFF}):
+		return Type{"image/jpeg", ".jpg"}, true
+	case bytes.HasPrefix(h, []byte("GIF87a")), bytes.HasPrefix(h, []byte("GIF89a")):
+		return Type{"image/gif", ".gif"}, true
+	case bytes.HasPrefix(h, []byte("%PDF-")):
+		return Type{"application/pdf", ".pdf"}, true
+	case bytes.HasPrefix(h, []byte("PK\x03\x04")):
+		return detectZip(h), true
+	case bytes.HasPrefix(h, []byte{0x1F, 0x8B}):
+		return Type{"application/gzip", ".gz"}, true
+	case bytes.HasPrefix(h, []byte("\x7FELF")):
+		return Type{"application/x-executable", ""}, true
+	case bytes.HasPrefix(h, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(h[:min(len(h), 64)], []byte("webm")) {
+			return Type{"video/webm", ".webm"}, true
+		}
+		return Type{"video/x-matroska", ".mkv"}, true
+	case bytes.HasPrefix(h, []byte("ID3")), isMPEGAudioFrame(h):
+		return Type{"audio/mpeg", ".mp3"}, true
+	case bytes.HasPrefix(h, []byte("fLaC")):
+		return Type{"audio/flac", ".flac"}, true
+	case bytes.HasPrefix(h, []byte("OggS")):
+		return Type{"audio/ogg", ".ogg"}, true
+	case bytes.HasPrefix(h, []byte("#!")):
+		return detectShebang(h), true
+	}
+
+	if t, ok := detectISOBMFF(h); ok {
+		return t, true
+	}
+
+	return Type{}, false
+}
+
+// isMPEGAudioFrame checks for an MPEG audio frame sync without an ID3 tag.
+func isMPEGAudioFrame(h []byte) bool {
+	if len(h) < 2 || h[0] != 0xFF {
+		return false
+	}
+	// 11 sync bits, then a layer field that must not be "reserved" (00)
+	return h[1]&0xE0 == 0xE0 && h[1]&0x06 != 0
+}
+
+// detectISOBMFF recognizes MP4-family files by their leading "ftyp" box.
+func detectISOBMFF(h []byte) (Type, bool) {
+	if len(h) < 12 || string(h[4:8]) != "ftyp" {
+		return Type{}, false
+	}
+
+	switch brand := string(h[8:12]); brand {
+	case "M4A ", "M4B ":
+		return Type{"audio/mp4", ".m4a"}, true
+	case "qt  ":
+		return Type{"video/quicktime", ".mov"}, true
+	case "heic", "heix", "mif1", "msf1":
+		return Type{"image/heic", ".heic"}, true
+	case "avif":
+		return Type{"image/avif", ".avif"}, true
+	case "3gp4", "3gp5", "3gp6", "3g2a":
+		return Type{"video/3gpp", ".3gp"}, true
+	default:
+		return Type{"video/mp4", ".mp4"}, true
+	}
+}
+
+// detectZip tells OOXML and OpenDocument files apart from plain archives
+// by the entry names stored in the first local file headers.
+func detectZip(h []byte) Type {
+	switch {
+	case bytes.Contains(h, []byte("word/")):
+		return Type{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"}
+	case bytes.Contains(h, []byte("xl/")):
+		return Type{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"}
+	case bytes.Contains(h, []byte("ppt/")):
+		return Type{"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"}
+	case bytes.Contains(h, []byte("mimetypeapplication/vnd.oasis.opendocument.text")):
+		return Type{"application/vnd.oasis.opendocument.text", ".odt"}
+	case bytes.Contains(h, []byte("mimetypeapplication/vnd.oasis.opendocument.spreadsheet")):
+		return Type{"application/vnd.oasis.opendocument.spreadsheet", ".ods"}
+	case bytes.Contains(h, []byte("mimetypeapplication/epub+zip")):
+		return Type{"application/epub+zip", ".epub"}
+	}
+	return Type{"application/zip", ".zip"}
+}
+
+// detectShebang maps a "#!" interpreter line to a script type.
+func detectShebang(h []byte) Type {
+	line := h
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	interp := strings.TrimSpace(string(line[2:]))
+
+	// "#!/usr/bin/env python3" names the interpreter in its argument
+	fields := strings.Fields(interp)
+	if len(fields) > 1 && strings.HasSuffix(fields[0], "/env") {
+		interp = fields[1]
+	} else if len(fields) > 0 {
+		interp = fields[0]
+	}
+	if i := strings.LastIndexByte(interp, '/'); i >= 0 {
+		interp = interp[i+1:]
+	}
+
+	switch {
+	case strings.HasPrefix(interp, "python"):
+		return Type{"text/x-python", ".py"}
+	case strings.HasPrefix(interp, "node"):
+		return Type{"text/javascript", ".js"}
+	case strings.HasPrefix(interp, "perl"):
+		return Type{"text/x-perl", ".pl"}
+	case strings.HasPrefix(interp, "ruby"):
+		return Type{"text/x-ruby", ".rb"}
+	}
+	return Type{"text/x-shellscript", ".sh"}
+}
@@ -0,0 +1,80 @@
+package sniff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		mime   string
+		ext    string
+	}{
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "image/png", ".png"},
+		{"JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0}, "image/jpeg", ".jpg"},
+		{"GIF", []byte("GIF89a\x01\x00"), "image/gif", ".gif"},
+		{"PDF", []byte("%PDF-1.7\n"), "application/pdf", ".pdf"},
+		{"ZIP", []byte("PK\x03\x04\x14\x00\x00\x00notes.txt"), "application/zip", ".zip"},
+		{"DOCX", []byte("PK\x03\x04\x14\x00\x00\x00[Content_Types].xmlPK\x03\x04word/document.xml"),
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+		{"XLSX", []byte("PK\x03\x04\x14\x00\x00\x00xl/workbook.xml"),
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+		{"Gzip", []byte{0x1F, 0x8B, 0x08, 0x00}, "application/gzip", ".gz"},
+		{"ELF", []byte("\x7FELF\x02\x01\x01"), "application/x-executable", ""},
+		{"MP4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"), "video/mp4", ".mp4"},
+		{"M4A", []byte("\x00\x00\x00\x1cftypM4A \x00\x00\x00\x00"), "audio/mp4", ".m4a"},
+		{"HEIC", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic", ".heic"},
+		{"Matroska", []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x88matroska"), "video/x-matroska", ".mkv"},
+		{"WebM", []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"), "video/webm", ".webm"},
+		{"MP3 ID3", []byte("ID3\x04\x00\x00"), "audio/mpeg", ".mp3"},
+		{"MP3 Frame", []byte{0xFF, 0xFB, 0x90, 0x64}, "audio/mpeg", ".mp3"},
+		{"FLAC", []byte("fLaC\x00\x00\x00\x22"), "audio/flac", ".flac"},
+		{"Ogg", []byte("OggS\x00\x02"), "audio/ogg", ".ogg"},
+		{"Shell Script", []byte("#!/bin/sh\necho hi\n"), "text/x-shellscript", ".sh"},
+		{"Python Via Env", []byte("#!/usr/bin/env python3\nprint(1)\n"), "text/x-python", ".py"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Detect(tt.header)
+			if !ok {
+				t.Fatalf("Detect(%s) did not recognize the header", tt.name)
+			}
+			if got.MIME != tt.mime || got.Ext != tt.ext {
+				t.Errorf("Detect(%s) = %+v; want {%s %s}", tt.name, got, tt.mime, tt.ext)
+			}
+		})
+	}
+}
+
+func TestDetect_Unknown(t *testing.T) {
+	for _, header := range [][]byte{nil, []byte("plain text"), {0xFF}} {
+		if got, ok := Detect(header); ok {
+			t.Errorf("Detect(%q) = %+v; want no match", header, got)
+		}
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	path := filepath.Join(tmpDir, "download")
+	if err := os.WriteFile(path, []byte("%PDF-1.4\n%rest of the file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := DetectFile(path)
+	if err != nil {
+		t.Fatalf("DetectFile failed: %v", err)
+	}
+	if !ok || got.MIME != "application/pdf" {
+		t.Errorf("DetectFile = %+v, %v; want application/pdf", got, ok)
+	}
+
+	if _, _, err := DetectFile(filepath.Join(tmpDir, "missing")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,133 @@
+// Package trash moves files to the trash can described by the
+// freedesktop.org Trash specification, so desktop file managers can show
+// and restore them.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Item is a file put in a trash can.
+type Item struct {
+	// File is where the trashed file is now, in the can's files folder.
+	File string
+	// Info is its .trashinfo file.
+	Info string
+}
+
+// ErrUnsupported is returned where the platform has no freedesktop trash.
+var ErrUnsupported = errors.New("trash is not supported on this platform")
+
+// homeTrash returns the home trash can, $XDG_DATA_HOME/Trash or
+// ~/.local/share/Trash.
+func homeTrash() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Put moves the file at path into the trash can of its volume and writes
+// the .trashinfo file recording where it came from. The home trash is
+// used when the file lives on the same filesystem; otherwise the volume's
+// .Trash/$UID or .Trash-$UID folder.
+func Put(path string, now time.Time) (Item, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	can, topdir, err := canFor(abs)
+	if err != nil {
+		return Item{}, err
+	}
+
+	filesDir := filepath.Join(can, "files")
+	infoDir := filepath.Join(can, "info")
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return Item{}, fmt.Errorf("failed to create trash folder: %w", err)
+		}
+	}
+
+	// Volume trash cans record paths relative to the volume's top
+	// directory; the home trash records absolute paths
+	recorded := abs
+	if topdir != "" {
+		if rel, err := filepath.Rel(topdir, abs); err == nil {
+			recorded = rel
+		}
+	}
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		escapePath(recorded), now.Format("2006-01-02T15:04:05"))
+
+	// Claiming the info file first reserves the name in files/
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for n := 0; ; n++ {
+		name := base
+		if n > 0 {
+			name = fmt.Sprintf("%s_%d%s", stem, n, ext)
+		}
+		item := Item{
+			File: filepath.Join(filesDir, name),
+			Info: filepath.Join(infoDir, name+".trashinfo"),
+		}
+		f, err := os.OpenFile(item.Info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return Item{}, fmt.Errorf("failed to write trash info: %w", err)
+		}
+		if _, err := os.Lstat(item.File); err == nil {
+			// a stray file without info; leave it alone
+			f.Close()
+			os.Remove(item.Info)
+			continue
+		}
+		_, err = f.WriteString(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(item.Info)
+			return Item{}, fmt.Errorf("failed to write trash info: %w", err)
+		}
+
+		if err := os.Rename(abs, item.File); err != nil {
+			os.Remove(item.Info)
+			return Item{}, fmt.Errorf("failed to move file to trash: %w", err)
+		}
+		return item, nil
+	}
+}
+
+// Restore moves a trashed file back to path and removes its info file.
+func Restore(item Item, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.Rename(item.File, path); err != nil {
+		return err
+	}
+	if err := os.Remove(item.Info); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove trash info: %w", err)
+	}
+	return nil
+}
+
+// escapePath percent-encodes a path the way .trashinfo files expect.
+func escapePath(path string) string {
+	return (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath()
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package trash
+
+func canFor(path string) (string, string, error) {
+	return "", "", ErrUnsupported
+}
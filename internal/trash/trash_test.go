@@ -0,0 +1,55 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+
+	path := filepath.Join(tmpDir, "my notes.txt")
+	os.WriteFile(path, []byte("first"), 0644)
+	now := time.Date(2024, 1, 31, 18, 4, 5, 0, time.UTC)
+
+	item, err := Put(path, now)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "data", "Trash", "files", "my notes.txt"); item.File != want {
+		t.Errorf("File = %s, want %s", item.File, want)
+	}
+	info, _ := os.ReadFile(item.Info)
+	for _, line := range []string{"[Trash Info]", "Path=" + filepath.ToSlash(tmpDir) + "/my%20notes.txt", "DeletionDate=2024-01-31T18:04:05"} {
+		if !strings.Contains(string(info), line+"\n") {
+			t.Errorf("trash info lacks %q:\n%s", line, info)
+		}
+	}
+
+	// A second file of the same name gets its own slot
+	os.WriteFile(path, []byte("second"), 0644)
+	second, err := Put(path, now)
+	if err != nil {
+		t.Fatalf("second Put failed: %v", err)
+	}
+	if filepath.Base(second.File) != "my notes_1.txt" {
+		t.Errorf("second File = %s, want my notes_1.txt", second.File)
+	}
+
+	if err := Restore(item, path); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("restored content = %q", data)
+	}
+	if _, err := os.Stat(item.Info); !os.IsNotExist(err) {
+		t.Error("Restore should remove the info file")
+	}
+	if err := Restore(second, path); err == nil {
+		t.Error("Restore must not overwrite an existing file")
+	}
+}
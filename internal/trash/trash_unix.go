@@ -0,0 +1,83 @@
+//go:build unix
+
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// canFor returns the trash can for a file and, for a volume trash, the
+// top directory of the volume it belongs to.
+func canFor(path string) (string, string, error) {
+	dev, err := device(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	home, err := homeTrash()
+	if err != nil {
+		return "", "", err
+	}
+	if homeDev, err := device(existingParent(home)); err == nil && homeDev == dev {
+		return home, "", nil
+	}
+
+	topdir, err := mountPoint(path, dev)
+	if err != nil {
+		return "", "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	// An administrator-created .Trash must be a sticky directory and not
+	// a symlink to be used
+	shared := filepath.Join(topdir, ".Trash")
+	if fi, err := os.Lstat(shared); err == nil && fi.IsDir() && fi.Mode()&os.ModeSticky != 0 {
+		return filepath.Join(shared, uid), topdir, nil
+	}
+	return filepath.Join(topdir, ".Trash-"+uid), topdir, nil
+}
+
+func device(path string) (uint64, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no device number for %s", path)
+	}
+	return uint64(st.Dev), nil
+}
+
+// mountPoint returns the topmost directory above path on device dev.
+func mountPoint(path string, dev uint64) (string, error) {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		parentDev, err := device(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
+
+// existingParent returns path or its closest existing ancestor.
+func existingParent(path string) string {
+	for {
+		if _, err := os.Lstat(path); err == nil || filepath.Dir(path) == path {
+			return path
+		}
+		path = filepath.Dir(path)
+	}
+}